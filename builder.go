@@ -0,0 +1,147 @@
+package peg
+
+// GrammarBuilder defines a grammar with the operator constructors (Seq, Cho,
+// Ref, ...) instead of PEG text. Build runs the same checks as
+// NewParserWithUserRules on the defined rules. Its errors are *GrammarError
+// too, but without a position, as there is no grammar text: their details are
+// all at line 1, column 1.
+//
+//	b := NewGrammarBuilder()
+//	b.Rule("LIST", Seq(Ref("ITEM", nil, 0), Zom(Seq(Lit(","), Ref("ITEM", nil, 0)))))
+//	b.Rule("ITEM", Tok(Oom(Cls("a-z"))))
+//	b.Rule("%whitespace", Zom(Cls(" \t")))
+//	parser, err := b.Build()
+type GrammarBuilder struct {
+	data *data
+	opes []Operator // Operators used by parse functions, linked by Link
+}
+
+func NewGrammarBuilder() *GrammarBuilder {
+	return &GrammarBuilder{data: newData()}
+}
+
+// Rule defines a rule and returns it, so that an action or other handlers can
+// be attached to it. The first rule defined becomes the start rule. A name
+// starting with '~' defines a rule whose semantic value is ignored.
+func (b *GrammarBuilder) Rule(name string, ope Operator) *Rule {
+	return b.define(name, nil, ope)
+}
+
+// Macro defines a parameterized rule. References to the parameters are
+// written as Ref(param, nil, pos) in ope.
+func (b *GrammarBuilder) Macro(name string, params []string, ope Operator) *Rule {
+	if params == nil {
+		params = []string{}
+	}
+	return b.define(name, params, ope)
+}
+
+// Func defines a rule parsed by fn, a function written by GenerateGo.
+// describe returns the operator tree of the rule for the functions inspecting
+// the grammar, like EnableAst, Inspect and PrintGrammar; it is called on first
+// use.
+func (b *GrammarBuilder) Func(name string, fn ParseFunc, describe func() Operator) *Rule {
+	o := &compiled{fn: fn, describe: describe, grammar: b.data.grammar}
+	o.derived = o
+	return b.define(name, nil, o)
+}
+
+// Operator registers an operator that parse functions pass to Context.Match,
+// so that Link links its references, and returns it.
+func (b *GrammarBuilder) Operator(ope Operator) Operator {
+	b.opes = append(b.opes, ope)
+	return ope
+}
+
+func (b *GrammarBuilder) define(name string, params []string, ope Operator) *Rule {
+	ignore := false
+	if len(name) > 0 && name[0] == '~' {
+		ignore = true
+		name = name[1:]
+	}
+
+	r := &Rule{
+		Ope:        ope,
+		Name:       name,
+		Ignore:     ignore,
+		Parameters: params,
+	}
+
+	data := b.data
+	if _, ok := data.grammar[name]; ok {
+		// No position, like all the errors of the builder
+		data.duplicates = append(data.duplicates, duplicate{name, 0})
+		return r
+	}
+	data.grammar[name] = r
+	data.names = append(data.names, name)
+	if len(data.start) == 0 {
+		data.start = name
+	}
+	return r
+}
+
+// Start sets the start rule.
+func (b *GrammarBuilder) Start(name string) {
+	b.data.start = name
+}
+
+// Option adds a value to an option of the grammar (%expr or %binop) like a
+// line 'name = value' in the options section of PEG text.
+func (b *GrammarBuilder) Option(name string, value string) {
+	b.data.options[name] = append(b.data.options[name], value)
+}
+
+// Build checks the grammar, links the references and returns the parser.
+func (b *GrammarBuilder) Build() (*Parser, error) {
+	if _, ok := b.data.grammar[b.data.start]; !ok {
+		return nil, startRuleError(b.data)
+	}
+	return newParser("", b.data)
+}
+
+// Link links the references and returns the parser without checking the
+// grammar, for grammars checked before, like the ones of the code written by
+// GenerateGo. The grammar isn't linted either, so Warnings is empty.
+func (b *GrammarBuilder) Link() (*Parser, error) {
+	data := b.data
+	if _, ok := data.grammar[data.start]; !ok {
+		return nil, startRuleError(data)
+	}
+
+	// Operators of Func rules are linked on first use
+	for _, r := range data.grammar {
+		if _, ok := r.Ope.(*compiled); !ok {
+			r.accept(&linkReferences{parameters: r.Parameters, grammar: data.grammar})
+		}
+	}
+	for _, ope := range b.opes {
+		ope.accept(&linkReferences{grammar: data.grammar})
+	}
+
+	p := assembleParser(data)
+	name, info := getExpressionParsingOptions(data.options)
+	if err := EnableExpressionParsing(p, name, info); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// startRuleError returns the error of a start rule that isn't defined, with
+// the defined rules of similar names as suggestions.
+func startRuleError(data *data) error {
+	name := data.start
+	gerr := &GrammarError{
+		BaseError: Error{Type: GrammarErrorType},
+		RuleName:  name,
+		ErrorType: "undefined rule",
+	}
+	ln, col := lineInfo("", 0)
+	gerr.BaseError.Details = append(gerr.BaseError.Details, ErrorDetail{ln, col, "start rule '" + name + "' is not defined.", ""})
+	if similar := similarNames(name, data.names); len(similar) > 0 {
+		gerr.suggestions = append(gerr.suggestions, "'"+name+"' is not defined. Did you mean "+quoteNames(similar)+"?")
+	} else if len(data.names) > 0 {
+		gerr.suggestions = append(gerr.suggestions, "Start with one of the defined rules: "+quoteNames(data.names)+".")
+	}
+	return gerr
+}
@@ -0,0 +1,90 @@
+package peg
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// The byte slice variants of the parse functions do not copy the input. All
+// strings handed to actions (Values.SS, Values.S, Token.S) and stored in Ast
+// nodes share the memory of the slice, so the slice must not be modified while
+// they are in use. The Bytes methods return these strings as sub-slices of the
+// input without copying them. The sub-slices are read-only: they must not be
+// modified, and when the input was a string, writing to them faults. Errors
+// copy the input lines they quote only, so the suggestions of syntax errors
+// don't look at the input.
+
+// bytesToString returns a string sharing the memory of b.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// stringToBytes returns a read-only byte slice sharing the memory of s.
+func stringToBytes(s string) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// Bytes returns the token text as a read-only sub-slice of the input.
+func (t Token) Bytes() []byte {
+	return stringToBytes(t.S)
+}
+
+// Bytes returns the matched text as a read-only sub-slice of the input.
+func (v *Values) Bytes() []byte {
+	return stringToBytes(v.S)
+}
+
+// TokenBytes returns the token text as a read-only sub-slice of the input.
+func (v *Values) TokenBytes() []byte {
+	return stringToBytes(v.Token())
+}
+
+// TokenBytes returns the token text as a read-only sub-slice of the input.
+func (ast *Ast) TokenBytes() []byte {
+	return stringToBytes(ast.Token)
+}
+
+// ParseBytes is like Parse, but operates on a byte slice without copying it.
+func (r *Rule) ParseBytes(b []byte, d Any) (l int, val Any, err error) {
+	l, val, err = r.Parse(bytesToString(b), d)
+	err = detachError(err)
+	return
+}
+
+// ParseBytes is like Parse, but operates on a byte slice without copying it.
+func (p *Parser) ParseBytes(b []byte, d Any) (err error) {
+	_, err = p.ParseBytesAndGetValue(b, d)
+	return
+}
+
+// ParseBytesAndGetValue is like ParseAndGetValue, but operates on a byte slice
+// without copying it.
+func (p *Parser) ParseBytesAndGetValue(b []byte, d Any) (val Any, err error) {
+	val, err = p.ParseAndGetValue(bytesToString(b), d)
+	err = detachError(err)
+	return
+}
+
+// detachError copies the input lines quoted by err, so that the error stays
+// valid after the input slice is reused. A SyntaxError drops the input instead
+// of copying it, so its suggestions don't look at the input.
+func detachError(err error) error {
+	var details []ErrorDetail
+	switch e := err.(type) {
+	case *Error:
+		details = e.Details
+	case *SyntaxError:
+		details = e.BaseError.Details
+		e.input, e.trial = "", nil
+	}
+	for i := range details {
+		details[i].Line = strings.Clone(details[i].Line)
+	}
+	return err
+}
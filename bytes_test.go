@@ -0,0 +1,54 @@
+package peg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT  <- WORD (',' WORD)*
+		WORD  <- < [a-z]+ >
+		%whitespace <- [ \t]*
+	`)
+
+	input := []byte("abc, de ,f")
+
+	var words [][]byte
+	parser.Grammar["WORD"].Action = func(v *Values, d Any) (Any, error) {
+		words = append(words, v.TokenBytes())
+		return nil, nil
+	}
+
+	assert(t, parser.ParseBytes(input, nil) == nil)
+	assert(t, len(words) == 3)
+	assert(t, string(words[1]) == "de")
+	assert(t, &words[1][0] == &input[5])
+
+	_, _, err := parser.Grammar["WORD"].ParseBytes([]byte("abc1"), nil)
+	assert(t, err != nil)
+}
+
+func TestParseBytesAst(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT  <- WORD+
+		WORD  <- < [a-z]+ >
+		%whitespace <- [ \t]*
+	`)
+	parser.EnableAst()
+
+	input := []byte("abc de")
+	val, err := parser.ParseBytesAndGetValue(input, nil)
+	assert(t, err == nil)
+
+	ast := val.(*Ast)
+	assert(t, bytes.Equal(ast.Nodes[1].TokenBytes(), []byte("de")))
+	assert(t, &ast.Nodes[1].TokenBytes()[0] == &input[4])
+
+	input = []byte("1 abc")
+	_, err = parser.ParseBytesAndGetValue(input, nil)
+	assert(t, err != nil)
+	input[2] = 'x'
+	assert(t, err.(*SyntaxError).BaseError.Details[0].Line == "1 abc")
+	assert(t, err.(*SyntaxError).input == "")
+}
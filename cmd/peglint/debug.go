@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var debugUsageMessage = `usage: peglint debug [-f path] [-s string] [grammar path]
+
+peglint debug parses the source text step by step. The parser stops when it enters or leaves a rule, and commands read from standard input control it:
+
+    b rule | b @offset    set a breakpoint on a rule or on the rules starting at an input offset
+    d rule | d @offset    delete a breakpoint
+    l                     list the breakpoints
+    s                     step into: go to the next rule entered or left
+    n                     step over: go to the next rule that isn't nested in the current one
+    o                     step out: go until the current rule is left
+    c                     continue to the next breakpoint
+    bt                    print the rules being parsed
+    v                     print the semantic values of the rules being parsed
+    t                     print the captured tokens
+    e                     print the farthest error position and the expected tokens
+    i                     print the input with a cursor at the current position
+    r                     restart the parse
+    q                     quit
+
+An empty line repeats the last command.
+
+The -f 'path' specifies a file path to the source text.
+
+The -s 'string' specifies the source text.
+`
+
+const debugHelp = `b rule | b @offset  set a breakpoint    d rule | d @offset  delete a breakpoint
+l  list breakpoints  s  step into  n  step over  o  step out  c  continue
+bt  rules being parsed  v  values  t  tokens  e  farthest error  i  input
+r  restart  q  quit`
+
+func runDebug(args []string) {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, debugUsageMessage)
+		os.Exit(1)
+	}
+	sourcePath := fs.String("f", "", "source file path")
+	sourceStr := fs.String("s", "", "source string")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (*sourcePath == "") == (*sourceStr == "") {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	source := *sourceStr
+	if *sourcePath != "" {
+		dat, err := ioutil.ReadFile(*sourcePath)
+		check(err)
+		source = string(dat)
+	}
+
+	repl := &debugREPL{
+		dbg:    peg.NewDebugger(parser),
+		source: source,
+		w:      os.Stdout,
+	}
+	repl.run(os.Stdin)
+}
+
+type debugREPL struct {
+	dbg    *peg.Debugger
+	source string
+	stop   *peg.DebugStop
+	w      io.Writer
+}
+
+func (r *debugREPL) run(in io.Reader) {
+	r.restart()
+
+	scanner := bufio.NewScanner(in)
+	last := ""
+	for {
+		fmt.Fprint(r.w, "(peg) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.w)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		if line == "" {
+			continue
+		}
+		if !r.command(strings.Fields(line)) {
+			return
+		}
+	}
+}
+
+// command runs a command, and returns false to quit.
+func (r *debugREPL) command(args []string) bool {
+	switch args[0] {
+	case "b", "break":
+		if len(args) < 2 {
+			fmt.Fprintln(r.w, "usage: b rule | b @offset")
+		} else if pos, ok := r.offset(args[1]); ok {
+			r.dbg.BreakPos(pos)
+		} else if err := r.dbg.BreakRule(args[1]); err != nil {
+			fmt.Fprintln(r.w, err)
+		}
+	case "d", "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(r.w, "usage: d rule | d @offset")
+		} else if pos, ok := r.offset(args[1]); ok {
+			r.dbg.ClearPos(pos)
+		} else {
+			r.dbg.ClearRule(args[1])
+		}
+	case "l", "list":
+		rules, positions := r.dbg.Breakpoints()
+		for _, name := range rules {
+			fmt.Fprintln(r.w, name)
+		}
+		for _, pos := range positions {
+			fmt.Fprintf(r.w, "@%d\n", pos)
+		}
+	case "s", "step":
+		r.show(r.dbg.StepInto())
+	case "n", "next":
+		r.show(r.dbg.StepOver())
+	case "o", "out":
+		r.show(r.dbg.StepOut())
+	case "c", "continue":
+		r.show(r.dbg.Continue())
+	case "bt":
+		if r.stopped() {
+			for i := len(r.stop.Frames) - 1; i >= 0; i-- {
+				f := r.stop.Frames[i]
+				ln, col := lineCol(r.source, f.Pos)
+				fmt.Fprintf(r.w, "#%d %s at %d:%d\n", len(r.stop.Frames)-1-i, f.Rule, ln, col)
+			}
+		}
+	case "v", "values":
+		if r.stopped() {
+			stack := r.stop.ValuesStack()
+			for i := len(stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(r.w, "#%d %s\n", len(stack)-1-i, formatValues(stack[i].Vs))
+			}
+		}
+	case "t", "tokens":
+		if r.stopped() {
+			for _, v := range r.stop.ValuesStack() {
+				for _, t := range v.Ts {
+					ln, col := lineCol(r.source, t.Pos)
+					fmt.Fprintf(r.w, "%d:%d %q\n", ln, col, t.S)
+				}
+			}
+		}
+	case "e", "error":
+		if r.stopped() {
+			pos := r.stop.ErrorPos()
+			if pos < 0 {
+				fmt.Fprintln(r.w, "no error")
+			} else {
+				ln, col := lineCol(r.source, pos)
+				fmt.Fprintf(r.w, "farthest error at %d:%d (offset %d)\n", ln, col, pos)
+				if expected := r.stop.ExpectedTokens(); len(expected) > 0 {
+					fmt.Fprintf(r.w, "expected %s\n", strings.Join(expected, ", "))
+				}
+				r.cursor(pos)
+			}
+		}
+	case "i", "input":
+		if r.stopped() {
+			r.cursor(r.stop.Pos)
+		}
+	case "r", "restart":
+		r.restart()
+	case "q", "quit":
+		r.dbg.Abort()
+		return false
+	case "h", "help":
+		fmt.Fprintln(r.w, debugHelp)
+	default:
+		fmt.Fprintf(r.w, "unknown command '%s', type 'h' for help\n", args[0])
+	}
+	return true
+}
+
+func (r *debugREPL) restart() {
+	r.show(r.dbg.Start(r.source, nil))
+}
+
+// offset parses '@offset'.
+func (r *debugREPL) offset(arg string) (int, bool) {
+	if !strings.HasPrefix(arg, "@") {
+		return 0, false
+	}
+	pos, err := strconv.Atoi(arg[1:])
+	return pos, err == nil
+}
+
+func (r *debugREPL) stopped() bool {
+	if r.stop == nil {
+		fmt.Fprintln(r.w, "the parse has finished, type 'r' to restart")
+		return false
+	}
+	return true
+}
+
+// show prints where the debugger stopped, or the result of the parse.
+func (r *debugREPL) show(stop *peg.DebugStop) {
+	r.stop = stop
+	if stop == nil {
+		if _, err := r.dbg.Result(); err != nil {
+			fmt.Fprintf(r.w, "parse failed:\n%v\n", err)
+		} else {
+			fmt.Fprintln(r.w, "parse succeeded")
+		}
+		return
+	}
+
+	ln, col := lineCol(r.source, stop.Pos)
+	indent := strings.Repeat("  ", stop.RuleDepth)
+	switch {
+	case !stop.Leave:
+		fmt.Fprintf(r.w, "%senter %s at %d:%d\n", indent, stop.Rule.Name, ln, col)
+	case stop.Success():
+		fmt.Fprintf(r.w, "%sleave %s at %d:%d: matched %q\n", indent, stop.Rule.Name, ln, col, stop.S[stop.Pos:stop.Pos+stop.Len])
+	default:
+		fmt.Fprintf(r.w, "%sleave %s at %d:%d: failed\n", indent, stop.Rule.Name, ln, col)
+	}
+}
+
+// cursor prints the line of the input at pos with a cursor under pos.
+func (r *debugREPL) cursor(pos int) {
+	start := strings.LastIndex(r.source[:pos], "\n") + 1
+	end := strings.Index(r.source[pos:], "\n")
+	if end == -1 {
+		end = len(r.source)
+	} else {
+		end += pos
+	}
+	fmt.Fprintln(r.w, r.source[start:end])
+	fmt.Fprintln(r.w, strings.Repeat(" ", len([]rune(r.source[start:pos])))+"^")
+}
+
+// lineCol returns the line and the column of pos, in bytes like the errors
+// of the parser.
+func lineCol(s string, pos int) (ln, col int) {
+	ln = strings.Count(s[:pos], "\n") + 1
+	col = pos - (strings.LastIndex(s[:pos], "\n") + 1) + 1
+	return
+}
+
+func formatValues(vs []peg.Any) string {
+	var items []string
+	for _, v := range vs {
+		items = append(items, fmt.Sprintf("%v", v))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var diagramUsageMessage = `usage: peglint diagram [-html] [-o path] [-rule name] [grammar path]
+
+peglint diagram draws railroad diagrams of the rules of a grammar.
+
+By default, it writes an SVG file for each rule, named after the rule, into the directory given by -o (default: the current directory). References to other rules link to their files.
+
+The -html flag writes a single HTML page with the diagrams of all rules to the file given by -o, or to standard output.
+
+The -rule 'name' flag writes only the SVG diagram of the rule, to the file given by -o or to standard output.
+`
+
+func runDiagram(args []string) {
+	fs := flag.NewFlagSet("diagram", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, diagramUsageMessage)
+		os.Exit(1)
+	}
+	htmlPage := fs.Bool("html", false, "write a single HTML page")
+	outPath := fs.String("o", "", "output directory or file path")
+	rule := fs.String("rule", "", "write the diagram of the rule only")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	switch {
+	case *htmlPage:
+		writeOutput(*outPath, func(w io.Writer) error {
+			return peg.WriteRailroadHTML(w, parser)
+		})
+	case *rule != "":
+		writeOutput(*outPath, func(w io.Writer) error {
+			return peg.WriteRailroadSVG(w, parser, *rule)
+		})
+	default:
+		dir := *outPath
+		if dir == "" {
+			dir = "."
+		}
+		check(os.MkdirAll(dir, 0755))
+		for _, name := range parser.RuleNames() {
+			writeOutput(filepath.Join(dir, name+".svg"), func(w io.Writer) error {
+				return peg.WriteRailroadSVG(w, parser, name)
+			})
+		}
+	}
+}
+
+// writeOutput calls write with the file at path, or standard output if path
+// is empty.
+func writeOutput(path string, write func(w io.Writer) error) {
+	if path == "" {
+		check(write(os.Stdout))
+		return
+	}
+	f, err := os.Create(path)
+	check(err)
+	check(write(f))
+	check(f.Close())
+}
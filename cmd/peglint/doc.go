@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var docUsageMessage = `usage: peglint doc [-o path] [grammar path]
+
+peglint doc generates a Markdown reference of a grammar. Each rule has a section with the comment lines written right before its definition, its PEG definition, and links to the rules it references and the rules using it.
+
+The -o 'path' flag writes the reference to the file instead of standard output.
+`
+
+func runDoc(args []string) {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, docUsageMessage)
+		os.Exit(1)
+	}
+	outPath := fs.String("o", "", "output file path")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	writeOutput(*outPath, func(w io.Writer) error {
+		return peg.WriteGrammarMarkdown(w, parser)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	peg "github.com/yhirose/go-peg"
+	"github.com/yhirose/go-peg/internal/diff"
+)
+
+var fmtUsageMessage = `usage: peglint fmt [-w] [-d] [grammar path ...]
+
+peglint fmt formats PEG grammar files. Definitions are aligned, arrows are normalized to '<-', spacing in expressions is normalized and comments are kept. Without a path, it formats standard input.
+
+The -w flag writes the result back to the grammar file instead of printing it.
+
+The -d flag prints a diff of the changes instead of the result.
+`
+
+func runFmt(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, fmtUsageMessage)
+		os.Exit(1)
+	}
+	write := fs.Bool("w", false, "write result to grammar file")
+	showDiff := fs.Bool("d", false, "show diff")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "peglint fmt: cannot use -w with standard input")
+			os.Exit(1)
+		}
+		dat, err := ioutil.ReadAll(os.Stdin)
+		check(err)
+		formatGrammar("<standard input>", dat, false, *showDiff)
+		return
+	}
+
+	for _, path := range fs.Args() {
+		dat, err := ioutil.ReadFile(path)
+		check(err)
+		formatGrammar(path, dat, *write, *showDiff)
+	}
+}
+
+func formatGrammar(path string, dat []byte, write bool, showDiff bool) {
+	res, err := peg.FormatGrammar(string(dat))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, path+":")
+		pcheck(err)
+	}
+
+	if showDiff {
+		fmt.Print(diff.Unified(path+".orig", path, string(dat), res))
+	}
+
+	if write {
+		if res != string(dat) {
+			check(ioutil.WriteFile(path, []byte(res), 0644))
+		}
+	} else if !showDiff {
+		fmt.Print(res)
+	}
+}
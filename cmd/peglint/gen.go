@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var genUsageMessage = `usage: peglint gen [-pkg name] [-func name] [-o path] [grammar path]
+
+peglint gen generates a Go source file with a parse function specialized for each rule of a grammar. The generated function builds the parser without parsing or checking the grammar text at runtime, and returns a *peg.Parser, so actions are attached to its Grammar as usual.
+
+The -pkg 'name' specifies the package name of the generated file (default: main).
+
+The -func 'name' specifies the name of the generated function (default: NewParser).
+
+The -o 'path' specifies the output file path. The default is standard output.
+`
+
+func runGen(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, genUsageMessage)
+		os.Exit(1)
+	}
+	pkg := fs.String("pkg", "main", "package name")
+	funcName := fs.String("func", "NewParser", "function name")
+	outPath := fs.String("o", "", "output file path")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		check(err)
+		defer f.Close()
+		w = f
+	}
+
+	check(peg.GenerateGo(w, parser, *pkg, *funcName))
+}
@@ -1,29 +1,71 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 
 	peg "github.com/yhirose/go-peg"
 )
 
-var usageMessage = `usage: peglint [-ast] [-opt] [-trace] [-f path] [-s string] [grammar path]
+var usageMessage = `usage: peglint [-lint] [-ast] [-opt] [-trace] [-trace-format format] [-trace-include patterns] [-trace-exclude patterns] [-trace-rules-only] [-trace-range start:end] [-trace-depth n] [-trace-farthest] [-trace-html path] [-cover path] [-rule-prof path] [-dot-grammar path] [-dot-ast path] [-stream rule] [-f path] [-s string] [grammar path]
+       peglint command [arguments]
 
 peglint checks syntax of a given PEG grammar file and reports errors. If the check is successful and a user gives a source file for the grammar, it will also check syntax of the source file.
 
+The -lint flag reports possible problems in the grammar: loops whose body can match an empty string, choice alternatives shadowed by a preceding literal, unused and unreachable rules, and predicates that always fail. peglint exits with status 1 if there are any.
+
 The -ast flag prints the AST (abstract syntax tree) of the source file.
 
 The -opt flag prints the optimized AST (abstract syntax tree) of the source file.
 
 The -trace flag can be used with the source file. It prints names of rules and operators that the PEG parser detects on standard error.
 
+The -trace-format 'format' flag selects the format of the trace: 'text' (default), or 'json' for a JSON object per line with the event, operator name, rule, position, depth and match length. Captured tokens are included.
+
+The trace can be filtered. The rule of an event is the innermost rule being parsed.
+
+    -trace-include 'patterns'  only events of rules matching one of the comma-separated glob patterns
+    -trace-exclude 'patterns'  no events of rules matching one of the patterns, like '%whitespace'
+    -trace-rules-only          only rules, not the other operators
+    -trace-range 'start:end'   only events at input offsets from start to before end; either can be omitted
+    -trace-depth 'n'           only events at depths up to n
+    -trace-farthest            only the failures at the farthest position, when the parse ends
+
+The -trace-html 'path' flag writes the trace of the parse of the source file as an HTML page: the input with the spans of the rules that matched, the collapsible tree of the rules tried with the failures in red, and a timeline of the input positions of the rules tried where backtracks are marked.
+
+The -cover 'path' flag writes a coverage report of the grammar for the source file: how many times each rule and each alternative of a choice matched, annotated over the grammar text. The report is an HTML page if the path ends with '.html', and text otherwise. '-' writes the text report to standard output.
+
+The -rule-prof 'path' flag profiles the rules of the grammar while parsing the source file. It prints a table of the calls, successes, failures, time, bytes consumed and re-invocations at the same position of each rule on standard error, and writes a profile in pprof format with the rules as functions to the path.
+
+The -dot-grammar 'path' flag writes the graph of the references between the rules of the grammar in the DOT language of Graphviz. The start rule has a double border, macros are filled, and references in recursive cycles are bold, in red for left recursion. '-' writes it to standard output.
+
+The -dot-ast 'path' flag writes the AST of the source file in the DOT language of Graphviz, optimized with -opt. '-' writes it to standard output.
+
+The -stream 'rule' flag reads the source file or string as a sequence of items of the given rule, without loading the whole file into memory. The reports of -cover and -rule-prof cover all the items, and -trace-html, -recovery and -dot-ast can't be used with it.
+
 The -f 'path' specifies a file path to the source text.
 
 The -s 'string' specifies the source text.
+
+Commands:
+
+    debug        step through the parse of a source text
+    diagram      draw railroad diagrams of the rules of a grammar
+    doc          generate a Markdown reference of a grammar
+    fmt          format grammar files
+    gen          generate Go code building the parser of a grammar
+    gen-samples  generate random strings accepted by a grammar
+    reduce       shrink a source file failing to parse
+    test         check a grammar against a corpus of sample inputs
+
+Run 'peglint command -h' for the usage of a command.
 `
 
 func usage() {
@@ -32,12 +74,26 @@ func usage() {
 }
 
 var (
+	lintFlag       = flag.Bool("lint", false, "report grammar warnings")
 	astFlag        = flag.Bool("ast", false, "show ast")
 	optFlag        = flag.Bool("opt", false, "show optimized ast")
 	traceFlag      = flag.Bool("trace", false, "show trace message")
+	traceFormat    = flag.String("trace-format", "text", "trace format: text or json")
+	traceInclude   = flag.String("trace-include", "", "trace only rules matching the comma-separated patterns")
+	traceExclude   = flag.String("trace-exclude", "", "don't trace rules matching the comma-separated patterns")
+	traceRules     = flag.Bool("trace-rules-only", false, "trace rules only")
+	traceRange     = flag.String("trace-range", "", "trace only input offsets in start:end")
+	traceDepth     = flag.Int("trace-depth", 0, "trace only depths up to n")
+	traceFarthest  = flag.Bool("trace-farthest", false, "trace only failures at the farthest position")
 	sourceFilePath = flag.String("f", "", "source file path")
 	sourceString   = flag.String("s", "", "source string")
 	profPath       = flag.String("prof", "", "write cpu profile to file")
+	streamRule     = flag.String("stream", "", "parse the source file as a stream of items of the rule")
+	traceHTMLPath  = flag.String("trace-html", "", "write the trace as an HTML page to file")
+	coverPath      = flag.String("cover", "", "write a coverage report to file")
+	ruleProfPath   = flag.String("rule-prof", "", "write a profile of the grammar rules to file")
+	dotGrammarPath = flag.String("dot-grammar", "", "write the rule graph in DOT to file")
+	dotASTPath     = flag.String("dot-ast", "", "write the ast in DOT to file")
 )
 
 func check(err error) {
@@ -63,6 +119,21 @@ func pcheck(err error) {
 			}
 		}
 
+		os.Exit(1)
+	} else if gerr, ok := err.(*peg.GrammarError); ok {
+		fmt.Println("Grammar error details:")
+		for _, d := range gerr.BaseError.Details {
+			fmt.Println(d)
+		}
+
+		suggestions := gerr.GetSuggestions()
+		if len(suggestions) > 0 {
+			fmt.Println("\nSuggestions:")
+			for _, suggestion := range suggestions {
+				fmt.Println("- " + suggestion)
+			}
+		}
+
 		os.Exit(1)
 	} else if syntaxErr, ok := err.(*peg.SyntaxError); ok {
 		fmt.Println("Syntax error details:")
@@ -81,20 +152,63 @@ func pcheck(err error) {
 		}
 
 		os.Exit(1)
+	} else {
+		check(err)
 	}
 }
 
+// splitPatterns splits a comma-separated list of patterns.
+func splitPatterns(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// parseRange parses 'start:end' where either offset can be omitted.
+func parseRange(s string) (start, end int) {
+	if s == "" {
+		return
+	}
+	i := strings.Index(s, ":")
+	if i == -1 {
+		check(fmt.Errorf("invalid range '%s': expected start:end", s))
+	}
+	var err error
+	if i > 0 {
+		start, err = strconv.Atoi(s[:i])
+		check(err)
+	}
+	if i+1 < len(s) {
+		end, err = strconv.Atoi(s[i+1:])
+		check(err)
+	}
+	return
+}
+
 func SetupTracer(p *peg.Parser) {
+	start, end := parseRange(*traceRange)
+
 	// Use the new tracing options
 	p.EnableTracing(&peg.TracingOptions{
-		ShowRuleEntry:    true,
-		ShowRuleExit:     true,
-		ShowTokens:       false,
-		ShowErrorContext: true,
-		OutputFormat:     "text",
+		ShowRuleEntry:        true,
+		ShowRuleExit:         true,
+		ShowTokens:           true,
+		ShowErrorContext:     true,
+		OutputFormat:         *traceFormat,
+		Output:               os.Stderr,
+		IncludeRules:         splitPatterns(*traceInclude),
+		ExcludeRules:         splitPatterns(*traceExclude),
+		RulesOnly:            *traceRules,
+		StartPos:             start,
+		EndPos:               end,
+		MaxDepth:             *traceDepth,
+		FarthestFailuresOnly: *traceFarthest,
 	})
 
-	fmt.Println("Tracing enabled. Parser will show rule entry/exit and error context.")
+	if *traceFormat != "json" {
+		fmt.Println("Tracing enabled. Parser will show rule entry/exit and error context.")
+	}
 }
 
 var (
@@ -102,7 +216,26 @@ var (
 	maxErrorsFlag = flag.Int("max-errors", 10, "maximum number of errors to report")
 )
 
+// Subcommands
+var commands = map[string]func(args []string){
+	"debug":       runDebug,
+	"diagram":     runDiagram,
+	"doc":         runDoc,
+	"fmt":         runFmt,
+	"gen":         runGen,
+	"gen-samples": runGenSamples,
+	"reduce":      runReduce,
+	"test":        runTest,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = usage
 	flag.Parse()
 	args := flag.Args()
@@ -117,6 +250,24 @@ func main() {
 	parser, err := peg.NewParser(string(dat))
 	pcheck(err)
 
+	if *lintFlag && len(parser.Warnings) > 0 {
+		for _, w := range parser.Warnings {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", args[0], w)
+		}
+		os.Exit(1)
+	}
+
+	if *dotGrammarPath != "" {
+		writeOutput(dotPath(*dotGrammarPath), func(w io.Writer) error {
+			return peg.WriteGrammarDOT(w, parser)
+		})
+	}
+
+	if *streamRule != "" && (*sourceFilePath != "" || *sourceString != "") {
+		streamSource(parser)
+		return
+	}
+
 	var source string
 
 	if *sourceFilePath != "" {
@@ -140,10 +291,12 @@ func main() {
 			SetupTracer(parser)
 		}
 
-		if *astFlag || *optFlag {
+		if *astFlag || *optFlag || *dotASTPath != "" {
 			parser.EnableAst()
 		}
 
+		writeReports := setupReports(parser)
+
 		// Enable error recovery if requested
 		if *recoveryFlag {
 			parser.RecoveryEnabled = true
@@ -161,6 +314,7 @@ func main() {
 		if *recoveryFlag {
 			// Use recovery mode parsing
 			val, errs := parser.ParseAndGetValueWithRecovery(source, nil)
+			writeReports()
 			if len(errs) > 0 {
 				fmt.Printf("Parsing completed with %d errors\n", len(errs))
 				for i, err := range errs {
@@ -185,27 +339,153 @@ func main() {
 				fmt.Println("Parsing completed successfully")
 			}
 
-			if val != nil && (*astFlag || *optFlag) {
-				ast := val.(*peg.Ast)
-				if *optFlag {
-					opt := peg.NewAstOptimizer(nil)
-					ast = opt.Optimize(ast, nil)
-				}
-				fmt.Println(ast)
+			if val != nil && (*astFlag || *optFlag || *dotASTPath != "") {
+				showAst(val.(*peg.Ast))
 			}
 		} else {
 			// Use normal parsing
 			val, err := parser.ParseAndGetValue(source, nil)
+			writeReports()
 			pcheck(err)
 
-			if *astFlag || *optFlag {
-				ast := val.(*peg.Ast)
-				if *optFlag {
-					opt := peg.NewAstOptimizer(nil)
-					ast = opt.Optimize(ast, nil)
-				}
-				fmt.Println(ast)
+			if *astFlag || *optFlag || *dotASTPath != "" {
+				showAst(val.(*peg.Ast))
 			}
 		}
 	}
 }
+
+// showAst prints the AST if -ast or -opt is given, and writes it in DOT if
+// -dot-ast is given.
+func showAst(ast *peg.Ast) {
+	if *optFlag {
+		opt := peg.NewAstOptimizer(nil)
+		ast = opt.Optimize(ast, nil)
+	}
+	if *astFlag || *optFlag {
+		fmt.Println(ast)
+	}
+	if *dotASTPath != "" {
+		writeOutput(dotPath(*dotASTPath), func(w io.Writer) error {
+			return peg.WriteAstDOT(w, ast)
+		})
+	}
+}
+
+// dotPath returns the path for writeOutput of a DOT flag, where '-' is
+// standard output.
+func dotPath(path string) string {
+	if path == "-" {
+		return ""
+	}
+	return path
+}
+
+// writeCoverage writes the report of cov to path, as HTML if the path ends
+// with ".html".
+func writeCoverage(cov *peg.Coverage, path string) {
+	if path == "-" {
+		check(cov.WriteText(os.Stdout))
+		return
+	}
+
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+	if strings.HasSuffix(path, ".html") {
+		check(cov.WriteHTML(f))
+	} else {
+		check(cov.WriteText(f))
+	}
+}
+
+// writeProfile prints the table of prof on standard error and writes its
+// pprof profile to path.
+func writeProfile(prof *peg.Profiler, path string) {
+	check(prof.WriteTable(os.Stderr))
+
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+	check(prof.WritePprof(f))
+}
+
+// setupReports sets the observers of the -cover, -rule-prof and -trace-html
+// flags on the parser, and returns the function writing their reports.
+func setupReports(parser *peg.Parser) func() {
+	var observers []peg.Observer
+	var cov *peg.Coverage
+	if *coverPath != "" {
+		cov = peg.NewCoverage(parser)
+		observers = append(observers, cov)
+	}
+	var prof *peg.Profiler
+	if *ruleProfPath != "" {
+		prof = peg.NewProfiler(parser)
+		observers = append(observers, prof)
+	}
+	var recorder *peg.TraceRecorder
+	if *traceHTMLPath != "" {
+		recorder = peg.NewTraceRecorder()
+		observers = append(observers, recorder)
+	}
+	if len(observers) > 0 {
+		parser.Observer = peg.MultiObserver(observers...)
+	}
+	return func() {
+		if cov != nil {
+			writeCoverage(cov, *coverPath)
+		}
+		if prof != nil {
+			writeProfile(prof, *ruleProfPath)
+		}
+		if recorder != nil {
+			f, err := os.Create(*traceHTMLPath)
+			check(err)
+			check(recorder.WriteHTML(f))
+			check(f.Close())
+		}
+	}
+}
+
+// streamSource parses the source as a stream of items. The coverage and the
+// profile cover all the items, while the flags working on a single parse of
+// the whole source are rejected.
+func streamSource(parser *peg.Parser) {
+	if *traceHTMLPath != "" || *recoveryFlag || *dotASTPath != "" {
+		check(errors.New("-stream can't be used with -trace-html, -recovery or -dot-ast."))
+	}
+
+	var r io.Reader = os.Stdin
+	if *sourceString != "" {
+		r = strings.NewReader(*sourceString)
+	} else if *sourceFilePath != "-" {
+		f, err := os.Open(*sourceFilePath)
+		check(err)
+		defer f.Close()
+		r = f
+	}
+
+	if *traceFlag {
+		SetupTracer(parser)
+	}
+
+	if *astFlag || *optFlag {
+		parser.EnableAst()
+	}
+	writeReports := setupReports(parser)
+
+	err := parser.ParseReader(r, *streamRule, nil, func(val peg.Any) error {
+		if *astFlag || *optFlag {
+			ast := val.(*peg.Ast)
+			if *optFlag {
+				opt := peg.NewAstOptimizer(nil)
+				ast = opt.Optimize(ast, nil)
+			}
+			fmt.Println(ast)
+		}
+		return nil
+	})
+	writeReports()
+	pcheck(err)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var reduceUsageMessage = `usage: peglint reduce [-o path] [grammar path] [source path]
+
+peglint reduce shrinks a source file that fails to parse to a small input failing with the same error message at the same rule, for a bug report. It first removes the text matched by whole rules, then lines and characters.
+
+The -o 'path' flag writes the reduced input to the file instead of standard output.
+`
+
+func runReduce(args []string) {
+	fs := flag.NewFlagSet("reduce", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, reduceUsageMessage)
+		os.Exit(1)
+	}
+	outPath := fs.String("o", "", "output file path")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	dat, err = ioutil.ReadFile(fs.Arg(1))
+	check(err)
+	source := string(dat)
+
+	keep, err := peg.SameFailure(parser, source)
+	check(err)
+	parses := 0
+	reduced := peg.Reduce(parser, source, func(s string) bool {
+		parses++
+		return keep(s)
+	})
+	fmt.Fprintf(os.Stderr, "reduced %d bytes to %d bytes in %d parses\n", len(source), len(reduced), parses)
+
+	writeOutput(*outPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, reduced)
+		return err
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+var genSamplesUsageMessage = `usage: peglint gen-samples [-n count] [-rule name] [-seed n] [-depth n] [-repeat n] [-o path] [grammar path]
+
+peglint gen-samples generates random strings accepted by a grammar, for fuzzing the code using the parser. Each string is checked with the parser, so strings rejected by predicates are generated again.
+
+The -n 'count' flag sets the number of strings (default: 10).
+
+The -rule 'name' flag generates strings of the rule instead of the start rule.
+
+The -seed 'n' flag seeds the random choices, to generate the same strings again.
+
+The -depth 'n' flag sets the depth of the rules after which the shortest way to finish a string is taken (default: 12), and the -repeat 'n' flag the maximum number of repetitions of '*' and '+' (default: 3).
+
+By default, the strings are printed one per line. The -o 'path' flag writes each string to a file 'sample-N.txt' in the directory instead, which keeps strings spanning lines apart.
+`
+
+func runGenSamples(args []string) {
+	fs := flag.NewFlagSet("gen-samples", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, genSamplesUsageMessage)
+		os.Exit(1)
+	}
+	count := fs.Int("n", 10, "number of strings")
+	rule := fs.String("rule", "", "rule of the strings")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed")
+	depth := fs.Int("depth", 12, "depth of the rules")
+	repeat := fs.Int("repeat", 3, "maximum number of repetitions")
+	outDir := fs.String("o", "", "output directory")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+
+	if *rule == "" {
+		*rule = parser.Start()
+	}
+
+	g := peg.NewSampleGenerator(parser, *seed)
+	g.MaxDepth = *depth
+	g.MaxRepeat = *repeat
+
+	if *outDir != "" {
+		check(os.MkdirAll(*outDir, 0755))
+	}
+	for i := 1; i <= *count; i++ {
+		s, err := g.SampleRule(*rule)
+		check(err)
+		if *outDir != "" {
+			path := filepath.Join(*outDir, fmt.Sprintf("sample-%d.txt", i))
+			check(ioutil.WriteFile(path, []byte(s), 0644))
+		} else {
+			fmt.Println(s)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	peg "github.com/yhirose/go-peg"
+	"github.com/yhirose/go-peg/internal/diff"
+)
+
+var testUsageMessage = `usage: peglint test [-update] [-opt] [-run regexp] [-cover path] [grammar path] [corpus path ...]
+
+peglint test parses the cases of corpus files with a grammar and compares the results with the expected ones. A corpus path can be a directory, in which case all files in it are read.
+
+A corpus file is a sequence of cases. Each case has a name between lines of '=' characters, the input, a line of '-' characters and the expected result: the AST in the format peglint -ast prints, or 'error at line:col' for an input that must fail at the given position. The input is the text between the name and the '-' line as is, with the newline of its last line. Blank lines around the result are ignored.
+
+    ==================
+    Addition
+    ==================
+    1 + 2
+    ---
+    + EXPR
+      - NUMBER ("1")
+      - OP ("+")
+      - NUMBER ("2")
+
+The -update flag rewrites the expected results of the corpus files with the actual ones.
+
+The -opt flag compares optimized ASTs.
+
+The -run 'regexp' flag runs only the cases whose name matches the regular expression.
+
+The -cover 'path' flag writes a coverage report of the grammar for all cases run, like peglint -cover.
+`
+
+func runTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, testUsageMessage)
+		os.Exit(1)
+	}
+	update := fs.Bool("update", false, "rewrite expected results")
+	optimize := fs.Bool("opt", false, "compare optimized ASTs")
+	run := fs.String("run", "", "run only cases matching the regular expression")
+	cover := fs.String("cover", "", "write a coverage report to file")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		filter, err = regexp.Compile(*run)
+		check(err)
+	}
+
+	dat, err := ioutil.ReadFile(fs.Arg(0))
+	check(err)
+	parser, err := peg.NewParser(string(dat))
+	pcheck(err)
+	parser.EnableAst()
+
+	var cov *peg.Coverage
+	if *cover != "" {
+		cov = peg.NewCoverage(parser)
+		parser.Observer = cov
+	}
+
+	var paths []string
+	for _, arg := range fs.Args()[1:] {
+		check(filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				paths = append(paths, path)
+			}
+			return err
+		}))
+	}
+
+	total, failed := 0, 0
+	for _, path := range paths {
+		n, nfailed, err := testCorpusFile(os.Stdout, parser, path, filter, *update, *optimize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		total += n
+		failed += nfailed
+	}
+
+	if cov != nil {
+		writeCoverage(cov, *cover)
+	}
+
+	switch {
+	case *update:
+		fmt.Printf("updated %d cases\n", total)
+	case failed > 0:
+		fmt.Printf("FAIL: %d of %d cases\n", failed, total)
+		os.Exit(1)
+	default:
+		fmt.Printf("ok: %d cases\n", total)
+	}
+}
+
+// testCorpusFile runs the cases of a corpus file whose name matches filter,
+// if any, and prints the differences of the failed ones to w. With update, it
+// rewrites the file with the actual results instead.
+func testCorpusFile(w io.Writer, parser *peg.Parser, path string, filter *regexp.Regexp, update, optimize bool) (total, failed int, err error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	corpus, err := parseCorpus(string(dat))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s:%v", path, err)
+	}
+
+	for _, c := range corpus.cases {
+		if filter != nil && !filter.MatchString(c.name) {
+			continue
+		}
+		total++
+		actual := corpusResult(parser, c.input, optimize)
+		if update {
+			c.expected = actual
+		} else if actual != c.expected {
+			failed++
+			fmt.Fprintf(w, "FAIL: %s:%d: %s\n", path, c.line, c.name)
+			fmt.Fprint(w, diff.Unified("expected", "actual", withNewline(c.expected), withNewline(actual)))
+		}
+	}
+
+	if update {
+		if res := corpus.String(); res != string(dat) {
+			err = ioutil.WriteFile(path, []byte(res), 0644)
+		}
+	}
+	return
+}
+
+// corpusResult returns the AST of the input, or the position of the error.
+func corpusResult(parser *peg.Parser, input string, optimize bool) string {
+	val, err := parser.ParseAndGetValue(input, nil)
+	if err != nil {
+		var details []peg.ErrorDetail
+		switch e := err.(type) {
+		case *peg.Error:
+			details = e.Details
+		case *peg.SyntaxError:
+			details = e.BaseError.Details
+		}
+		if len(details) == 0 {
+			return "error: " + err.Error()
+		}
+		return fmt.Sprintf("error at %d:%d", details[0].Ln, details[0].Col)
+	}
+
+	ast, ok := val.(*peg.Ast)
+	if !ok {
+		return ""
+	}
+	if optimize {
+		ast = peg.NewAstOptimizer(nil).Optimize(ast, nil)
+	}
+	return strings.TrimRight(ast.String(), "\n")
+}
+
+func withNewline(s string) string {
+	if s == "" {
+		return s
+	}
+	return s + "\n"
+}
+
+type corpusCase struct {
+	name     string
+	line     int    // Line of the case in the corpus file
+	head     string // Text from the header to the separator, kept by updates
+	input    string
+	expected string
+}
+
+type corpus struct {
+	prefix string // Text in front of the first case
+	cases  []*corpusCase
+}
+
+func isCorpusRule(line string, ch byte) bool {
+	line = strings.TrimRight(line, " \t\r")
+	return len(line) >= 3 && strings.Trim(line, string(ch)) == ""
+}
+
+// trimBlankLines joins lines without the blank lines around them.
+func trimBlankLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseCorpus(src string) (*corpus, error) {
+	lines := strings.Split(src, "\n")
+	crp := &corpus{}
+
+	i := 0
+	for i < len(lines) && !isCorpusRule(lines[i], '=') {
+		i++
+	}
+	crp.prefix = strings.Join(lines[:i], "\n")
+	if i > 0 {
+		crp.prefix += "\n"
+	}
+
+	for i < len(lines) {
+		c := &corpusCase{line: i + 1}
+		start := i
+
+		// Name
+		i++
+		var name []string
+		for i < len(lines) && !isCorpusRule(lines[i], '=') {
+			name = append(name, strings.TrimSpace(lines[i]))
+			i++
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("%d: the header of the case isn't closed.", c.line)
+		}
+		c.name = trimBlankLines(name)
+		i++
+
+		// Input
+		inputStart := i
+		for i < len(lines) && !isCorpusRule(lines[i], '-') {
+			i++
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("%d: '%s' has no '---' line.", c.line, c.name)
+		}
+		if i > inputStart {
+			c.input = strings.Join(lines[inputStart:i], "\n") + "\n"
+		}
+		i++
+		c.head = strings.Join(lines[start:i], "\n") + "\n"
+
+		// Expected result
+		expectedStart := i
+		for i < len(lines) && !isCorpusRule(lines[i], '=') {
+			i++
+		}
+		var expected []string
+		for _, line := range lines[expectedStart:i] {
+			expected = append(expected, strings.TrimRight(line, "\r"))
+		}
+		c.expected = trimBlankLines(expected)
+
+		crp.cases = append(crp.cases, c)
+	}
+	return crp, nil
+}
+
+func (crp *corpus) String() string {
+	var b strings.Builder
+	b.WriteString(crp.prefix)
+	for i, c := range crp.cases {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(c.head)
+		if c.expected != "" {
+			b.WriteString(c.expected)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
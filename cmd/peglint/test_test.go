@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+const testCorpus = `Cases of the line grammar
+
+==================
+Word
+==================
+abc
+---
++ LINE
+  - WORD ("abc")
+
+==========
+Empty line
+==========
+
+---
++ LINE
+
+=========
+Two lines
+=========
+abc
+def
+---
+error at 2:1
+`
+
+func TestParseCorpus(t *testing.T) {
+	crp, err := parseCorpus(testCorpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crp.prefix != "Cases of the line grammar\n\n" {
+		t.Errorf("prefix is %q", crp.prefix)
+	}
+	if len(crp.cases) != 3 {
+		t.Fatalf("%d cases", len(crp.cases))
+	}
+
+	expected := []corpusCase{
+		{name: "Word", line: 3, input: "abc\n", expected: "+ LINE\n  - WORD (\"abc\")"},
+		{name: "Empty line", line: 11, input: "\n", expected: "+ LINE"},
+		{name: "Two lines", line: 18, input: "abc\ndef\n", expected: "error at 2:1"},
+	}
+	for i, c := range crp.cases {
+		e := expected[i]
+		if c.name != e.name || c.line != e.line || c.input != e.input || c.expected != e.expected {
+			t.Errorf("case %d is %+v, expected %+v", i, *c, e)
+		}
+	}
+
+	if s := crp.String(); s != testCorpus {
+		t.Errorf("corpus is printed as:\n%s", s)
+	}
+
+	// Inputs are kept exactly
+	crp, err = parseCorpus("===\nCRLF\r\n===\r\na \r\n\r\n---\r\nok\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := crp.cases[0]; c.input != "a \r\n\r\n" || c.expected != "ok" {
+		t.Errorf("case is %+v", *c)
+	}
+
+	for _, src := range []string{"===\nName\n", "===\nName\n===\ninput\n"} {
+		if _, err := parseCorpus(src); err == nil {
+			t.Errorf("no error for %q", src)
+		}
+	}
+}
+
+func TestCorpusFile(t *testing.T) {
+	parser, err := peg.NewParser(`
+        LINE <- WORD? '\n'
+        WORD <- < [a-z]+ >
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser.EnableAst()
+
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lines.txt")
+
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() string {
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(dat)
+	}
+
+	write(testCorpus)
+	var out bytes.Buffer
+	total, failed, err := testCorpusFile(&out, parser, path, nil, false, false)
+	if err != nil || total != 3 || failed != 0 {
+		t.Fatalf("%d of %d cases failed: %v\n%s", failed, total, err, out.String())
+	}
+
+	// Failures are reported with a diff
+	wrong := strings.Replace(testCorpus, `WORD ("abc")`, `WORD ("abd")`, 1)
+	write(wrong)
+	out.Reset()
+	total, failed, err = testCorpusFile(&out, parser, path, nil, false, false)
+	if err != nil || total != 3 || failed != 1 {
+		t.Fatalf("%d of %d cases failed: %v", failed, total, err)
+	}
+	if !strings.HasPrefix(out.String(), "FAIL: "+path+":3: Word\n") || !strings.Contains(out.String(), "-  - WORD (\"abd\")\n+  - WORD (\"abc\")\n") {
+		t.Errorf("output:\n%s", out.String())
+	}
+
+	// -update rewrites the expected results only
+	total, failed, err = testCorpusFile(&out, parser, path, nil, true, false)
+	if err != nil || total != 3 || failed != 0 {
+		t.Fatalf("%d of %d cases failed: %v", failed, total, err)
+	}
+	if s := read(); s != testCorpus {
+		t.Errorf("updated corpus:\n%s", s)
+	}
+}
@@ -0,0 +1,116 @@
+package peg
+
+import "sync"
+
+// ParseFunc is the parse function of a rule written by GenerateGo. It matches
+// s at p, adds the semantic values to v, and returns the length of the match,
+// or -1 if it fails.
+type ParseFunc func(c Context, s string, p int, v *Values, d Any) int
+
+// Context is the state of a parse passed to the functions written by
+// GenerateGo. Its methods do the work of the operators the generated code
+// doesn't inline, and are not meant to be used otherwise.
+type Context struct {
+	c *context
+}
+
+// Match parses s at p with an operator, usually a rule.
+func (c Context) Match(ope Operator, s string, p int, v *Values, d Any) int {
+	return ope.parse(s, p, v, c.c, d)
+}
+
+// Push returns new values for the operands of a choice or a predicate.
+func (c Context) Push() *Values {
+	return c.c.push()
+}
+
+// Pop releases the values returned by the last Push.
+func (c Context) Pop() {
+	c.c.pop()
+}
+
+// Choose adds the values chv of the matching alternative id of a choice to v.
+func (c Context) Choose(v *Values, chv *Values, id int) {
+	v.Vs = append(v.Vs, chv.Vs...)
+	v.Pos = chv.Pos
+	v.S = chv.S
+	v.Choice = id
+	v.Ts = append(v.Ts, chv.Ts...)
+}
+
+// ErrorPos returns the farthest error position.
+func (c Context) ErrorPos() int {
+	return c.c.errorPos
+}
+
+// SetErrorPos restores the farthest error position to pos.
+func (c Context) SetErrorPos(pos int) {
+	c.c.errorPos = pos
+}
+
+// Fail records a failure at pos, and the token expected there if any.
+func (c Context) Fail(pos int, expected string) {
+	c.c.setErrorPos(pos)
+	if expected != "" {
+		c.c.addExpectedToken(expected)
+	}
+}
+
+// HitEnd records that the parse looked past the end of the input.
+func (c Context) HitEnd() {
+	c.c.hitEnd = true
+}
+
+// BeginToken starts a token boundary.
+func (c Context) BeginToken() {
+	c.c.inToken = true
+}
+
+// EndToken ends a token boundary whose operand matched l bytes at p, and
+// returns the length of the token and the whitespace after it.
+func (c Context) EndToken(s string, p int, l int, v *Values, d Any) int {
+	c.c.inToken = false
+	if success(l) {
+		v.Ts = append(v.Ts, Token{p, s[p : p+l]})
+
+		// Skip whiltespace
+		if c.c.whitespaceOpe != nil {
+			len := c.c.whitespaceOpe.parse(s, p+l, v, c.c, d)
+			if fail(len) {
+				return -1
+			}
+			l += len
+		}
+	}
+	return l
+}
+
+// Compiled operator, the operator of a rule defined with GrammarBuilder.Func
+type compiled struct {
+	opeBase
+	fn       ParseFunc
+	describe func() Operator
+	grammar  map[string]*Rule
+
+	initOpe sync.Once
+	ope     Operator
+}
+
+func (o *compiled) parseCore(s string, p int, v *Values, c *context, d Any) int {
+	return o.fn(Context{c}, s, p, v, d)
+}
+
+// description returns the operator tree the parse function was generated
+// from, built and linked on first use.
+func (o *compiled) description() Operator {
+	o.initOpe.Do(func() {
+		o.ope = o.describe()
+		o.ope.accept(&linkReferences{grammar: o.grammar})
+	})
+	return o.ope
+}
+
+// Visitors see the operator tree of the rule
+func (o *compiled) accept(v visitor) {
+	o.description().accept(v)
+}
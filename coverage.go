@@ -0,0 +1,330 @@
+package peg
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Coverage records how often the rules of a grammar and the alternatives of
+// its choices match. It is an Observer: set it as Parser.Observer and parse
+// any number of inputs.
+type Coverage struct {
+	parser  *Parser
+	rules   map[*Rule]*RuleCoverage
+	choices map[Operator]*ChoiceCoverage
+}
+
+// RuleCoverage is the coverage of a rule.
+type RuleCoverage struct {
+	Name    string
+	Calls   int // Number of times the rule was tried
+	Matches int
+	Choices []*ChoiceCoverage // Choices in the definition of the rule
+}
+
+// ChoiceCoverage is the coverage of a choice.
+type ChoiceCoverage struct {
+	Ope  Operator
+	Hits []int // Number of matches of each alternative
+}
+
+// NewCoverage returns a coverage collector for the grammar of p.
+func NewCoverage(p *Parser) *Coverage {
+	cov := &Coverage{
+		parser:  p,
+		rules:   make(map[*Rule]*RuleCoverage),
+		choices: make(map[Operator]*ChoiceCoverage),
+	}
+
+	for _, name := range p.RuleNames() {
+		r := p.Grammar[name]
+		rc := &RuleCoverage{Name: name}
+		WalkFunc(r.Ope, func(ope Operator) bool {
+			if node := Inspect(ope); node.Kind == ChoiceNode {
+				cc := &ChoiceCoverage{Ope: ope, Hits: make([]int, len(node.Opes))}
+				rc.Choices = append(rc.Choices, cc)
+				cov.choices[ope] = cc
+			}
+			return true
+		})
+		cov.rules[r] = rc
+	}
+	return cov
+}
+
+func (cov *Coverage) Enter(ev *ParseEvent) {}
+
+func (cov *Coverage) Leave(ev *ParseEvent) {
+	if ev.Rule != nil {
+		if rc, ok := cov.rules[ev.Rule]; ok {
+			rc.Calls++
+			if ev.Success() {
+				rc.Matches++
+			}
+		}
+	} else if ev.Success() {
+		ope := ev.Ope
+		if cho, ok := ope.(*prioritizedChoice); ok && cho.source != nil {
+			// A choice in a macro argument
+			ope = cho.source
+		}
+		if cc, ok := cov.choices[ope]; ok {
+			cc.Hits[ev.Values.Choice]++
+		}
+	}
+}
+
+// Rules returns the coverage of the rules in the order of RuleNames.
+func (cov *Coverage) Rules() []*RuleCoverage {
+	var rules []*RuleCoverage
+	for _, name := range cov.parser.RuleNames() {
+		if rc, ok := cov.rules[cov.parser.Grammar[name]]; ok {
+			rules = append(rules, rc)
+		}
+	}
+	return rules
+}
+
+// Summary returns the numbers of rules and of choice alternatives, and how
+// many of them matched at least once.
+func (cov *Coverage) Summary() (rules, matchedRules, alts, matchedAlts int) {
+	for _, rc := range cov.rules {
+		rules++
+		if rc.Matches > 0 {
+			matchedRules++
+		}
+		for _, cc := range rc.Choices {
+			for _, hits := range cc.Hits {
+				alts++
+				if hits > 0 {
+					matchedAlts++
+				}
+			}
+		}
+	}
+	return
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+func (cov *Coverage) summaryLine() string {
+	rules, matchedRules, alts, matchedAlts := cov.Summary()
+	return fmt.Sprintf("coverage: %d of %d rules matched (%.1f%%), %d of %d alternatives matched (%.1f%%)",
+		matchedRules, rules, percent(matchedRules, rules), matchedAlts, alts, percent(matchedAlts, alts))
+}
+
+// Alternative of a choice in the grammar text
+type coveredAlternative struct {
+	span sourceSpan
+	hits int
+}
+
+// source returns the grammar text, the rules defined in it and the
+// alternatives of their choices located in it.
+func (cov *Coverage) source() (src string, defined []*Rule, alts []coveredAlternative) {
+	for _, name := range cov.parser.RuleNames() {
+		r := cov.parser.Grammar[name]
+		if r.SS == "" {
+			continue
+		}
+		src = r.SS
+		defined = append(defined, r)
+		for _, cc := range cov.rules[r].Choices {
+			for i, alt := range Inspect(cc.Ope).Opes {
+				if span, ok := cov.parser.spans[alt]; ok {
+					alts = append(alts, coveredAlternative{span, cc.Hits[i]})
+				}
+			}
+		}
+	}
+	sort.SliceStable(alts, func(i, j int) bool { return alts[i].span.pos < alts[j].span.pos })
+	return
+}
+
+// undefined returns the coverage of the rules that aren't defined in grammar
+// text.
+func (cov *Coverage) undefined() []*RuleCoverage {
+	var rules []*RuleCoverage
+	for _, name := range cov.parser.RuleNames() {
+		if r := cov.parser.Grammar[name]; r.SS == "" {
+			rules = append(rules, cov.rules[r])
+		}
+	}
+	return rules
+}
+
+func coverageMark(n int) string {
+	if n == 0 {
+		return "!"
+	}
+	return ""
+}
+
+// WriteText writes the coverage as the grammar text with the matches and
+// calls of each rule in front of its definition, and the matches of the
+// choice alternatives starting on a line in a comment at its end. Counts of
+// zero are marked with '!'.
+func (cov *Coverage) WriteText(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(cov.summaryLine())
+	b.WriteString("\n\n")
+
+	src, defined, alts := cov.source()
+	if src != "" {
+		lines := strings.Split(strings.TrimRight(src, "\n"), "\n")
+		gutters := make([]string, len(lines))
+		notes := make([][]string, len(lines))
+
+		for _, r := range defined {
+			ln, _ := lineInfo(src, r.Pos)
+			if gutters[ln-1] == "" {
+				rc := cov.rules[r]
+				gutters[ln-1] = fmt.Sprintf("%s%d/%d", coverageMark(rc.Matches), rc.Matches, rc.Calls)
+			}
+		}
+		for _, alt := range alts {
+			ln, _ := lineInfo(src, alt.span.pos)
+			notes[ln-1] = append(notes[ln-1], fmt.Sprintf("%d%s", alt.hits, coverageMark(alt.hits)))
+		}
+
+		width := 0
+		for _, g := range gutters {
+			if len(g) > width {
+				width = len(g)
+			}
+		}
+
+		for i, line := range lines {
+			line = strings.TrimRight(line, " \t\r")
+			fmt.Fprintf(&b, "%*s | %s", width, gutters[i], line)
+			if len(notes[i]) > 0 {
+				fmt.Fprintf(&b, "  # %s", strings.Join(notes[i], " "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for _, rc := range cov.undefined() {
+		fmt.Fprintf(&b, "%s%d/%d %s", coverageMark(rc.Matches), rc.Matches, rc.Calls, rc.Name)
+		for _, cc := range rc.Choices {
+			b.WriteString("  #")
+			for _, hits := range cc.Hits {
+				fmt.Fprintf(&b, " %d%s", hits, coverageMark(hits))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+const coverageHTMLHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Grammar coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-size: 14px; line-height: 1.4; }
+.hit { background: #d8f5d8; }
+.miss { background: #f8d0d0; }
+.rule { font-weight: bold; }
+</style>
+</head>
+<body>
+`
+
+// WriteHTML writes the coverage as an HTML page showing the grammar text with
+// the rules and the choice alternatives that matched in green, and the others
+// in red. The counts are shown as tooltips.
+func (cov *Coverage) WriteHTML(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(coverageHTMLHeader)
+	fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(cov.summaryLine()))
+
+	type mark struct {
+		pos, end int
+		class    string
+		title    string
+	}
+
+	src, defined, alts := cov.source()
+	var marks []mark
+	for _, r := range defined {
+		rc := cov.rules[r]
+		class := "rule hit"
+		if rc.Matches == 0 {
+			class = "rule miss"
+		}
+		name := r.Pos
+		if strings.HasPrefix(src[name:], "~") {
+			name++
+		}
+		marks = append(marks, mark{name, name + len(r.Name), class, fmt.Sprintf("%s: %d matches, %d calls", r.Name, rc.Matches, rc.Calls)})
+	}
+	for _, alt := range alts {
+		class := "hit"
+		if alt.hits == 0 {
+			class = "miss"
+		}
+		marks = append(marks, mark{alt.span.pos, alt.span.end, class, fmt.Sprintf("%d matches", alt.hits)})
+	}
+	sort.SliceStable(marks, func(i, j int) bool {
+		if marks[i].pos != marks[j].pos {
+			return marks[i].pos < marks[j].pos
+		}
+		return marks[i].end > marks[j].end
+	})
+
+	b.WriteString("<pre>")
+	var open []int // Ends of the open marks
+	pos := 0
+	closeUntil := func(p int) {
+		for len(open) > 0 && open[len(open)-1] <= p {
+			end := open[len(open)-1]
+			b.WriteString(html.EscapeString(src[pos:end]))
+			b.WriteString("</span>")
+			pos = end
+			open = open[:len(open)-1]
+		}
+	}
+	for _, m := range marks {
+		closeUntil(m.pos)
+		if len(open) > 0 && m.end > open[len(open)-1] {
+			continue // Marks must nest
+		}
+		b.WriteString(html.EscapeString(src[pos:m.pos]))
+		fmt.Fprintf(&b, `<span class="%s" title="%s">`, m.class, html.EscapeString(m.title))
+		pos = m.pos
+		open = append(open, m.end)
+	}
+	closeUntil(len(src))
+	b.WriteString(html.EscapeString(src[pos:]))
+	b.WriteString("</pre>\n")
+
+	if rules := cov.undefined(); len(rules) > 0 {
+		b.WriteString("<ul>\n")
+		for _, rc := range rules {
+			class := "hit"
+			if rc.Matches == 0 {
+				class = "miss"
+			}
+			fmt.Fprintf(&b, "<li><span class=\"%s\">%s</span>: %d matches, %d calls</li>\n", class, html.EscapeString(rc.Name), rc.Matches, rc.Calls)
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
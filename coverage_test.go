@@ -0,0 +1,121 @@
+package peg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const coverageGrammar = `# Statements
+ROOT        <- STMT+
+STMT        <- 'print' EXPR ';'
+             / 'return' EXPR ';'
+EXPR        <- NUMBER / '(' EXPR ')' / ~NAME
+NUMBER      <- < [0-9]+ >
+NAME        <- < [a-z]+ >
+%whitespace <- [ \t\n]*
+`
+
+func TestCoverage(t *testing.T) {
+	p, _ := NewParser(coverageGrammar)
+	cov := NewCoverage(p)
+	p.Observer = cov
+
+	p.Parse("print 1; print (2);", nil)
+	p.Parse("print x", nil)
+
+	rules := make(map[string]*RuleCoverage)
+	for _, rc := range cov.Rules() {
+		rules[rc.Name] = rc
+	}
+	assert(t, rules["ROOT"].Calls == 2)
+	assert(t, rules["ROOT"].Matches == 1)
+	assert(t, rules["NAME"].Matches == 1)
+
+	stmt := rules["STMT"].Choices
+	assert(t, len(stmt) == 1)
+	assert(t, stmt[0].Hits[0] == 2 && stmt[0].Hits[1] == 0)
+
+	expr := rules["EXPR"].Choices
+	assert(t, expr[0].Hits[0] == 2 && expr[0].Hits[1] == 1 && expr[0].Hits[2] == 1)
+
+	rulesTotal, matchedRules, alts, matchedAlts := cov.Summary()
+	assert(t, rulesTotal == 6 && matchedRules == 6)
+	assert(t, alts == 5 && matchedAlts == 4)
+}
+
+func TestCoverageMacro(t *testing.T) {
+	p, _ := NewParser(`
+		ROOT       <- LIST('a' / 'b', ',' / ';')
+		LIST(I, D) <- I (D (I / '-'))*
+	`)
+	cov := NewCoverage(p)
+	p.Observer = cov
+
+	assert(t, p.Parse("a,b;a", nil) == nil)
+
+	rules := make(map[string]*RuleCoverage)
+	for _, rc := range cov.Rules() {
+		rules[rc.Name] = rc
+	}
+	root := rules["ROOT"].Choices
+	assert(t, len(root) == 2)
+	assert(t, root[0].Hits[0] == 2 && root[0].Hits[1] == 1)
+	assert(t, root[1].Hits[0] == 1 && root[1].Hits[1] == 1)
+
+	list := rules["LIST"].Choices
+	assert(t, len(list) == 1)
+	assert(t, list[0].Hits[0] == 2 && list[0].Hits[1] == 0)
+}
+
+func TestCoverageSpans(t *testing.T) {
+	p, _ := NewParser("ROOT <- 'a' 'b'  # first\n  / 'c' # second\n")
+	cho := p.Grammar["ROOT"].Ope.(*prioritizedChoice)
+	span := p.spans[cho.opes[0]]
+	assert(t, p.Grammar["ROOT"].SS[span.pos:span.end] == "'a' 'b'")
+	span = p.spans[cho.opes[1]]
+	assert(t, p.Grammar["ROOT"].SS[span.pos:span.end] == "'c'")
+}
+
+func TestCoverageText(t *testing.T) {
+	p, _ := NewParser(coverageGrammar)
+	cov := NewCoverage(p)
+	p.Observer = cov
+	p.Parse("print 1;", nil)
+
+	var b bytes.Buffer
+	if err := cov.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `coverage: 5 of 6 rules matched (83.3%), 2 of 5 alternatives matched (40.0%)
+
+     | # Statements
+ 1/1 | ROOT        <- STMT+
+ 1/1 | STMT        <- 'print' EXPR ';'  # 1
+     |              / 'return' EXPR ';'  # 0!
+ 1/1 | EXPR        <- NUMBER / '(' EXPR ')' / ~NAME  # 1 0! 0!
+ 1/1 | NUMBER      <- < [0-9]+ >
+!0/0 | NAME        <- < [a-z]+ >
+ 4/4 | %whitespace <- [ \t\n]*
+`
+	if b.String() != expected {
+		t.Errorf("coverage report:\n%s", b.String())
+	}
+}
+
+func TestCoverageHTML(t *testing.T) {
+	p, _ := NewParser(coverageGrammar)
+	cov := NewCoverage(p)
+	p.Observer = MultiObserver(cov, nil)
+	p.Parse("print 1;", nil)
+
+	var b bytes.Buffer
+	if err := cov.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	assert(t, strings.Contains(out, `<span class="rule miss" title="NAME: 0 matches, 0 calls">NAME</span>`))
+	assert(t, strings.Contains(out, `<span class="miss" title="0 matches">&#39;(&#39; EXPR &#39;)&#39;</span>`))
+	assert(t, strings.Contains(out, `<span class="hit" title="1 matches">&#39;print&#39; EXPR &#39;;&#39;</span>`))
+}
@@ -0,0 +1,251 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Debugger runs a parse step by step, stopping when the parser enters or
+// leaves a rule. The parse runs in its own goroutine, which waits while the
+// debugger is stopped, so the state of the parser can be inspected through
+// the ParseEvent of the stop.
+type Debugger struct {
+	parser *Parser
+
+	breakRules map[string]bool
+	breakPos   map[int]bool
+
+	// State of a running parse
+	running bool
+	stops   chan *DebugStop
+	resume  chan debugCommand
+	cmd     debugCommand
+	frames  []DebugFrame
+	val     Any
+	err     error
+}
+
+// DebugStop is a point where the debugger stopped.
+type DebugStop struct {
+	*ParseEvent
+	Leave     bool // Stopped when leaving the rule, with Len set
+	RuleDepth int  // Number of rules being parsed around the rule
+	Frames    []DebugFrame
+}
+
+// DebugFrame is a rule being parsed.
+type DebugFrame struct {
+	Rule string
+	Pos  int
+}
+
+type debugMode int
+
+const (
+	debugStepInto debugMode = iota
+	debugStepOver
+	debugStepOut
+	debugContinue
+	debugAbort
+)
+
+type debugCommand struct {
+	mode  debugMode
+	depth int // Rule depth of the stop the command was given at
+}
+
+// Panic value aborting the parse
+type debugAborted struct{}
+
+// NewDebugger returns a debugger for p.
+func NewDebugger(p *Parser) *Debugger {
+	return &Debugger{
+		parser:     p,
+		breakRules: make(map[string]bool),
+		breakPos:   make(map[int]bool),
+	}
+}
+
+// BreakRule sets a breakpoint stopping when the parser enters the rule.
+func (dbg *Debugger) BreakRule(name string) error {
+	if _, ok := dbg.parser.Grammar[name]; !ok {
+		return errors.New("'" + name + "' is not defined.")
+	}
+	dbg.breakRules[name] = true
+	return nil
+}
+
+// BreakPos sets a breakpoint stopping when the parser enters a rule at exactly
+// the offset of the input. The rules entered before the offset don't stop,
+// even if they match the text across it.
+func (dbg *Debugger) BreakPos(pos int) {
+	dbg.breakPos[pos] = true
+}
+
+// ClearRule removes the breakpoint on the rule.
+func (dbg *Debugger) ClearRule(name string) {
+	delete(dbg.breakRules, name)
+}
+
+// ClearPos removes the breakpoint on the offset.
+func (dbg *Debugger) ClearPos(pos int) {
+	delete(dbg.breakPos, pos)
+}
+
+// Breakpoints returns the rules and the offsets with breakpoints.
+func (dbg *Debugger) Breakpoints() (rules []string, positions []int) {
+	for name := range dbg.breakRules {
+		rules = append(rules, name)
+	}
+	sort.Strings(rules)
+	for pos := range dbg.breakPos {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	return
+}
+
+// Start starts parsing s, aborting a parse in progress, and stops when the
+// first rule is entered. The observer of the parser is still notified during
+// the parse.
+func (dbg *Debugger) Start(s string, d Any) *DebugStop {
+	dbg.Abort()
+
+	dbg.running = true
+	dbg.stops = make(chan *DebugStop)
+	dbg.resume = make(chan debugCommand)
+	dbg.cmd = debugCommand{mode: debugStepInto}
+	dbg.frames = nil
+	dbg.val, dbg.err = nil, nil
+
+	go func() {
+		defer close(dbg.stops)
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(debugAborted); !ok {
+					dbg.err = fmt.Errorf("panic: %v", r)
+				}
+			}
+		}()
+
+		observer := dbg.parser.Observer
+		dbg.parser.Observer = MultiObserver(observer, dbg)
+		defer func() { dbg.parser.Observer = observer }()
+
+		dbg.val, dbg.err = dbg.parser.ParseAndGetValue(s, d)
+	}()
+
+	return dbg.wait()
+}
+
+// StepInto continues to the next rule entered or left.
+func (dbg *Debugger) StepInto() *DebugStop {
+	return dbg.run(debugStepInto)
+}
+
+// StepOver continues to the next rule entered or left that isn't nested in
+// the current one.
+func (dbg *Debugger) StepOver() *DebugStop {
+	return dbg.run(debugStepOver)
+}
+
+// StepOut continues until the rule around the current one is left.
+func (dbg *Debugger) StepOut() *DebugStop {
+	return dbg.run(debugStepOut)
+}
+
+// Continue continues to the next breakpoint.
+func (dbg *Debugger) Continue() *DebugStop {
+	return dbg.run(debugContinue)
+}
+
+// Abort stops the parse in progress, if any.
+func (dbg *Debugger) Abort() {
+	if dbg.running {
+		dbg.run(debugAbort)
+	}
+}
+
+// Running reports whether a parse is in progress.
+func (dbg *Debugger) Running() bool {
+	return dbg.running
+}
+
+// Result returns the result of the last parse that finished.
+func (dbg *Debugger) Result() (val Any, err error) {
+	return dbg.val, dbg.err
+}
+
+// run resumes the parse with the command, and returns the next stop or nil
+// when the parse finished.
+func (dbg *Debugger) run(mode debugMode) *DebugStop {
+	if !dbg.running {
+		return nil
+	}
+	dbg.resume <- debugCommand{mode, len(dbg.frames)}
+	return dbg.wait()
+}
+
+func (dbg *Debugger) wait() *DebugStop {
+	stop, ok := <-dbg.stops
+	if !ok {
+		dbg.running = false
+		return nil
+	}
+	return stop
+}
+
+func (dbg *Debugger) Enter(ev *ParseEvent) {
+	if ev.Rule == nil {
+		return
+	}
+	dbg.frames = append(dbg.frames, DebugFrame{ev.Rule.Name, ev.Pos})
+	depth := len(dbg.frames) - 1
+
+	stop := false
+	switch dbg.cmd.mode {
+	case debugStepInto:
+		stop = true
+	case debugStepOver:
+		stop = depth < dbg.cmd.depth
+	}
+	if !stop {
+		stop = dbg.breakRules[ev.Rule.Name] || dbg.breakPos[ev.Pos]
+	}
+	if stop {
+		dbg.stop(&DebugStop{ParseEvent: ev, RuleDepth: depth})
+	}
+}
+
+func (dbg *Debugger) Leave(ev *ParseEvent) {
+	if ev.Rule == nil {
+		return
+	}
+	depth := len(dbg.frames) - 1
+
+	stop := false
+	switch dbg.cmd.mode {
+	case debugStepInto:
+		stop = true
+	case debugStepOver:
+		stop = depth < dbg.cmd.depth
+	case debugStepOut:
+		stop = depth < dbg.cmd.depth-1
+	}
+	if stop {
+		dbg.stop(&DebugStop{ParseEvent: ev, Leave: true, RuleDepth: depth})
+	}
+
+	dbg.frames = dbg.frames[:len(dbg.frames)-1]
+}
+
+// stop sends the stop to the debugger and waits for a command.
+func (dbg *Debugger) stop(stop *DebugStop) {
+	stop.Frames = append([]DebugFrame{}, dbg.frames...)
+	dbg.stops <- stop
+	dbg.cmd = <-dbg.resume
+	if dbg.cmd.mode == debugAbort {
+		panic(debugAborted{})
+	}
+}
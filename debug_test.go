@@ -0,0 +1,115 @@
+package peg
+
+import (
+	"testing"
+)
+
+const debugGrammar = `
+    ROOT <- A B
+    A    <- 'a'
+    B    <- C / 'b'
+    C    <- 'c'
+`
+
+func stopAt(t *testing.T, stop *DebugStop, rule string, leave bool, depth int) {
+	t.Helper()
+	if stop == nil {
+		t.Fatalf("expected a stop at %s", rule)
+	}
+	if stop.Rule.Name != rule || stop.Leave != leave || stop.RuleDepth != depth {
+		t.Errorf("stopped at %s (leave: %v, depth: %d), expected %s (leave: %v, depth: %d)",
+			stop.Rule.Name, stop.Leave, stop.RuleDepth, rule, leave, depth)
+	}
+}
+
+func TestDebuggerStep(t *testing.T) {
+	p, _ := NewParser(debugGrammar)
+	dbg := NewDebugger(p)
+
+	stopAt(t, dbg.Start("ab", nil), "ROOT", false, 0)
+	stopAt(t, dbg.StepInto(), "A", false, 1)
+
+	stop := dbg.StepOver()
+	stopAt(t, stop, "A", true, 1)
+	assert(t, stop.Success() && stop.Len == 1)
+
+	stopAt(t, dbg.StepOver(), "B", false, 1)
+
+	stop = dbg.StepInto()
+	stopAt(t, stop, "C", false, 2)
+	assert(t, stop.Pos == 1)
+	assert(t, len(stop.Frames) == 3)
+	assert(t, stop.Frames[1] == DebugFrame{"B", 1})
+
+	stop = dbg.StepInto()
+	stopAt(t, stop, "C", true, 2)
+	assert(t, !stop.Success())
+	assert(t, stop.ErrorPos() == 1)
+
+	stopAt(t, dbg.StepOut(), "B", true, 1)
+	stopAt(t, dbg.StepOut(), "ROOT", true, 0)
+
+	assert(t, dbg.StepInto() == nil)
+	assert(t, !dbg.Running())
+	_, err := dbg.Result()
+	assert(t, err == nil)
+	assert(t, p.Observer == nil)
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	p, _ := NewParser(debugGrammar)
+	dbg := NewDebugger(p)
+
+	assert(t, dbg.BreakRule("X") != nil)
+	assert(t, dbg.BreakRule("C") == nil)
+	dbg.BreakPos(1)
+
+	rules, positions := dbg.Breakpoints()
+	assert(t, len(rules) == 1 && rules[0] == "C")
+	assert(t, len(positions) == 1 && positions[0] == 1)
+
+	dbg.Start("ac", nil)
+	stopAt(t, dbg.Continue(), "B", false, 1)
+
+	stop := dbg.Continue()
+	stopAt(t, stop, "C", false, 2)
+	stack := stop.ValuesStack()
+	assert(t, len(stack) == 3) // Values of ROOT, B and the choice in B
+
+	dbg.ClearRule("C")
+	dbg.ClearPos(1)
+	assert(t, dbg.Continue() == nil)
+	_, err := dbg.Result()
+	assert(t, err == nil)
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	p, _ := NewParser(debugGrammar)
+	dbg := NewDebugger(p)
+
+	dbg.Start("ab", nil)
+	dbg.StepInto()
+	dbg.Abort()
+	assert(t, !dbg.Running())
+	assert(t, dbg.StepInto() == nil)
+
+	// A new parse after an aborted one
+	dbg.Start("ax", nil)
+	for dbg.Continue() != nil {
+	}
+	_, err := dbg.Result()
+	assert(t, err != nil)
+}
+
+func TestDebuggerObserver(t *testing.T) {
+	p, _ := NewParser(debugGrammar)
+	o := &countObserver{}
+	p.Observer = o
+
+	dbg := NewDebugger(p)
+	dbg.Start("ab", nil)
+	for dbg.Continue() != nil {
+	}
+	assert(t, o.enter > 0)
+	assert(t, p.Observer == o)
+}
@@ -0,0 +1,344 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Dimensions of railroad diagrams in pixels
+const (
+	rrCharWidth = 8  // Width of a character of a label
+	rrBoxHeight = 24 // Height of a box
+	rrGap       = 10 // Vertical gap between the tracks of a choice
+	rrRail      = 20 // Width of the rails around choices and loops
+	rrMargin    = 20 // Margin around a diagram
+)
+
+const railroadStyle = `svg.railroad { background: #fff; }
+svg.railroad path { stroke-width: 2; stroke: #333; fill: none; }
+svg.railroad rect { stroke-width: 2; stroke: #333; fill: #eef5fb; }
+svg.railroad rect.terminal { fill: #fdf6e3; }
+svg.railroad rect.param { fill: #f3eefb; }
+svg.railroad rect.group { stroke-width: 1; stroke-dasharray: 4 3; fill: none; }
+svg.railroad text { font: 14px monospace; text-anchor: middle; }
+svg.railroad text.label { font: 10px sans-serif; text-anchor: start; fill: #666; }
+svg.railroad a text { fill: #1a5fb4; }
+`
+
+// rrItem is an element of a railroad diagram. The track enters it on the
+// left and leaves it on the right, at the baseline, which is up pixels below
+// its top and down pixels above its bottom.
+type rrItem interface {
+	size() (width, up, down int)
+	render(b *bytes.Buffer, x, y int)
+}
+
+func rrPath(b *bytes.Buffer, format string, args ...interface{}) {
+	fmt.Fprintf(b, `<path d="`+format+`"/>`+"\n", args...)
+}
+
+// A box with a label: a terminal, a rule or a parameter
+type rrBox struct {
+	label string
+	class string
+	href  string
+	width int
+}
+
+func newRRBox(label, class, href string) *rrBox {
+	return &rrBox{label, class, href, len([]rune(label))*rrCharWidth + 20}
+}
+
+func (bx *rrBox) size() (int, int, int) {
+	return bx.width, rrBoxHeight / 2, rrBoxHeight / 2
+}
+
+func (bx *rrBox) render(b *bytes.Buffer, x, y int) {
+	rx := 0
+	if bx.class == "terminal" {
+		rx = rrBoxHeight / 2
+	}
+	fmt.Fprintf(b, `<rect class="%s" x="%d" y="%d" width="%d" height="%d" rx="%d"/>`+"\n",
+		bx.class, x, y-rrBoxHeight/2, bx.width, rrBoxHeight, rx)
+	text := fmt.Sprintf(`<text x="%d" y="%d">%s</text>`, x+bx.width/2, y+5, html.EscapeString(bx.label))
+	if bx.href != "" {
+		text = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(bx.href), text)
+	}
+	b.WriteString(text + "\n")
+}
+
+// An empty track
+type rrSkip struct{}
+
+func (rrSkip) size() (int, int, int) {
+	return rrRail, 0, 0
+}
+
+func (rrSkip) render(b *bytes.Buffer, x, y int) {
+	rrPath(b, "M%d %dh%d", x, y, rrRail)
+}
+
+type rrSequence []rrItem
+
+func (seq rrSequence) size() (width, up, down int) {
+	for i, item := range seq {
+		w, u, d := item.size()
+		if i > 0 {
+			width += rrGap
+		}
+		width += w
+		up = maxInt(up, u)
+		down = maxInt(down, d)
+	}
+	return
+}
+
+func (seq rrSequence) render(b *bytes.Buffer, x, y int) {
+	for i, item := range seq {
+		if i > 0 {
+			rrPath(b, "M%d %dh%d", x, y, rrGap)
+			x += rrGap
+		}
+		item.render(b, x, y)
+		w, _, _ := item.size()
+		x += w
+	}
+}
+
+// Alternatives stacked below the first one
+type rrChoice []rrItem
+
+// offsets returns the offsets of the baselines of the alternatives from the
+// baseline of the first one.
+func (ch rrChoice) offsets() []int {
+	offsets := make([]int, len(ch))
+	_, _, down := ch[0].size()
+	for i := 1; i < len(ch); i++ {
+		_, u, d := ch[i].size()
+		offsets[i] = maxInt(offsets[i-1]+down+rrGap+u, offsets[i-1]+2*rrGap)
+		down = d
+	}
+	return offsets
+}
+
+func (ch rrChoice) size() (width, up, down int) {
+	for _, item := range ch {
+		w, _, _ := item.size()
+		width = maxInt(width, w)
+	}
+	_, up, down = ch[0].size()
+	if len(ch) > 1 {
+		_, _, d := ch[len(ch)-1].size()
+		down = ch.offsets()[len(ch)-1] + d
+	}
+	return width + 2*rrRail, up, down
+}
+
+func (ch rrChoice) render(b *bytes.Buffer, x, y int) {
+	width, _, _ := ch.size()
+	inner := width - 2*rrRail
+	r := rrRail / 2
+	for i, item := range ch {
+		w, _, _ := item.size()
+		yi := y + ch.offsets()[i]
+		if i == 0 {
+			rrPath(b, "M%d %dh%d", x, y, rrRail)
+			rrPath(b, "M%d %dh%d", x+rrRail+w, y, inner-w+rrRail)
+		} else {
+			rrPath(b, "M%d %dq%d 0 %d %dv%dq0 %d %d %d", x, y, r, r, r, yi-y-2*r, r, r, r)
+			rrPath(b, "M%d %dh%dq%d 0 %d %dv%dq0 %d %d %d", x+rrRail+w, yi, inner-w, r, r, -r, -(yi - y - 2*r), -r, r, -r)
+		}
+		item.render(b, x+rrRail, yi)
+	}
+}
+
+// An item repeated along a track looping back below it
+type rrLoop struct {
+	item rrItem
+}
+
+func (lp rrLoop) size() (int, int, int) {
+	w, u, d := lp.item.size()
+	return w + 2*rrRail, u, maxInt(d+rrGap, 2*rrGap)
+}
+
+func (lp rrLoop) render(b *bytes.Buffer, x, y int) {
+	w, _, _ := lp.item.size()
+	_, _, down := lp.size()
+	r := rrRail / 2
+	rrPath(b, "M%d %dh%d", x, y, rrRail)
+	rrPath(b, "M%d %dh%d", x+rrRail+w, y, rrRail)
+	rrPath(b, "M%d %dq%d 0 %d %dv%dq0 %d %d %dh%dq%d 0 %d %dv%dq0 %d %d %d",
+		x+rrRail+w, y, r, r, r, down-2*r, r, -r, r, -w, -r, -r, -r, -(down - 2*r), -r, r, -r)
+	lp.item.render(b, x+rrRail, y)
+}
+
+// An item in a dashed box with a label, like a predicate or a token boundary
+type rrGroup struct {
+	item  rrItem
+	label string
+}
+
+const rrLabelHeight = 12
+
+func (g rrGroup) size() (int, int, int) {
+	w, u, d := g.item.size()
+	return maxInt(w, len(g.label)*6) + 2*rrGap, u + rrGap + rrLabelHeight, d + rrGap
+}
+
+func (g rrGroup) render(b *bytes.Buffer, x, y int) {
+	width, up, down := g.size()
+	w, _, _ := g.item.size()
+	fmt.Fprintf(b, `<rect class="group" x="%d" y="%d" width="%d" height="%d"/>`+"\n", x, y-up, width, up+down)
+	fmt.Fprintf(b, `<text class="label" x="%d" y="%d">%s</text>`+"\n", x+4, y-up+rrLabelHeight-2, html.EscapeString(g.label))
+	rrPath(b, "M%d %dh%d", x, y, rrGap)
+	g.item.render(b, x+rrGap, y)
+	rrPath(b, "M%d %dh%d", x+rrGap+w, y, width-rrGap-w)
+}
+
+// railroad builds the diagram of operators.
+type railroad struct {
+	href func(name string) string // Link to the diagram of a rule
+}
+
+func (rr *railroad) item(ope Operator) rrItem {
+	node := Inspect(ope)
+	switch node.Kind {
+	case SequenceNode:
+		var seq rrSequence
+		for _, o := range node.Opes {
+			seq = append(seq, rr.item(o))
+		}
+		if len(seq) == 0 {
+			return rrSkip{}
+		}
+		return seq
+	case ChoiceNode:
+		var ch rrChoice
+		for _, o := range node.Opes {
+			ch = append(ch, rr.item(o))
+		}
+		return ch
+	case ZeroOrMoreNode:
+		return rrChoice{rrLoop{rr.item(node.Opes[0])}, rrSkip{}}
+	case OneOrMoreNode:
+		return rrLoop{rr.item(node.Opes[0])}
+	case OptionNode:
+		return rrChoice{rr.item(node.Opes[0]), rrSkip{}}
+	case AndPredicateNode:
+		return rrGroup{rr.item(node.Opes[0]), "followed by"}
+	case NotPredicateNode:
+		return rrGroup{rr.item(node.Opes[0]), "not followed by"}
+	case TokenBoundaryNode:
+		return rrGroup{rr.item(node.Opes[0]), "token"}
+	case IgnoreNode:
+		return rrGroup{rr.item(node.Opes[0]), "ignored"}
+	case WhitespaceNode:
+		return rr.item(node.Opes[0])
+	case ExpressionNode:
+		atom, binop := node.Opes[0], node.Opes[1]
+		return rr.item(Seq(atom, Zom(Seq(binop, atom))))
+	case ReferenceNode:
+		if node.rule == nil {
+			return newRRBox(node.Name, "param", "")
+		}
+		label := node.Name
+		if len(node.Args) > 0 {
+			var args []string
+			for _, arg := range node.Args {
+				args = append(args, PrintOperator(arg))
+			}
+			label += "(" + strings.Join(args, ", ") + ")"
+		}
+		return newRRBox(label, "rule", rr.href(node.Name))
+	case RuleNode:
+		return newRRBox(node.Name, "rule", rr.href(node.Name))
+	case UserNode:
+		return newRRBox("%user", "terminal", "")
+	default:
+		return newRRBox(PrintOperator(ope), "terminal", "")
+	}
+}
+
+// render writes the diagram of a rule as an SVG element.
+func (rr *railroad) render(b *bytes.Buffer, r *Rule) {
+	item := rr.item(r.Ope)
+	w, up, down := item.size()
+	width := w + 2*rrMargin + 2*rrGap
+	height := up + down + 2*rrMargin
+	y := rrMargin + up
+
+	fmt.Fprintf(b, `<svg class="railroad" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(b, "<title>%s</title>\n", html.EscapeString(ruleHead(r)))
+
+	// Start and end marks
+	rrPath(b, "M%d %dv%dM%d %dh%d", rrMargin, y-rrGap, 2*rrGap, rrMargin, y, rrGap)
+	item.render(b, rrMargin+rrGap, y)
+	rrPath(b, "M%d %dh%dM%d %dv%d", rrMargin+rrGap+w, y, rrGap, rrMargin+2*rrGap+w, y-rrGap, 2*rrGap)
+	b.WriteString("</svg>\n")
+}
+
+// WriteRailroadSVG writes the railroad diagram of a rule as an SVG file.
+// References to other rules link to their SVG files named after the rules,
+// like 'EXPR.svg'.
+func WriteRailroadSVG(w io.Writer, p *Parser, name string) error {
+	r, ok := p.Grammar[name]
+	if !ok {
+		return errors.New("'" + name + "' is not defined.")
+	}
+
+	rr := &railroad{href: func(name string) string {
+		return url.PathEscape(name) + ".svg"
+	}}
+	var b bytes.Buffer
+	rr.render(&b, r)
+
+	// Embed the style
+	svg := b.String()
+	i := strings.Index(svg, "\n")
+	svg = svg[:i+1] + "<style>\n" + railroadStyle + "</style>\n" + svg[i+1:]
+
+	_, err := io.WriteString(w, svg)
+	return err
+}
+
+// WriteRailroadHTML writes the railroad diagrams of all rules of a grammar as
+// an HTML page, in the order of RuleNames. References to other rules link to
+// their diagrams.
+func WriteRailroadHTML(w io.Writer, p *Parser) error {
+	rr := &railroad{href: func(name string) string {
+		return "#" + railroadAnchor(name)
+	}}
+
+	var b bytes.Buffer
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Grammar</title>\n<style>\n")
+	b.WriteString("body { font-family: sans-serif; }\n")
+	b.WriteString(railroadStyle)
+	b.WriteString("</style>\n</head>\n<body>\n")
+	for _, name := range startFirst(p.RuleNames(), p.start) {
+		r := p.Grammar[name]
+		fmt.Fprintf(&b, "<h2 id=\"%s\">%s</h2>\n", railroadAnchor(name), html.EscapeString(ruleHead(r)))
+		rr.render(&b, r)
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func railroadAnchor(name string) string {
+	return "rule-" + url.PathEscape(name)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,98 @@
+package peg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+const diagramGrammar = `
+    ROOT        <- ITEM (',' ITEM)* / &'x' 'x'? LIST(NUMBER) / !'y' 'z'+
+    ITEM        <- NUMBER / NAME
+    LIST(X)     <- '[' X ']'
+    NUMBER      <- < [0-9]+ >
+    NAME        <- < [a-z]+ >
+    %whitespace <- [ ]*
+`
+
+// wellFormed checks that s is well-formed XML.
+func wellFormed(t *testing.T, s string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(s))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRailroadSVG(t *testing.T) {
+	p, _ := NewParser(diagramGrammar)
+
+	var b bytes.Buffer
+	if err := WriteRailroadSVG(&b, p, "ROOT"); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+	wellFormed(t, svg)
+
+	assert(t, strings.HasPrefix(svg, `<svg class="railroad" xmlns="http://www.w3.org/2000/svg"`))
+	assert(t, strings.Contains(svg, "<style>"))
+	assert(t, strings.Contains(svg, `<a href="ITEM.svg"><text x=`))
+	assert(t, strings.Contains(svg, `>LIST(NUMBER)</text></a>`))
+	assert(t, strings.Contains(svg, `<rect class="terminal"`))
+	assert(t, strings.Contains(svg, `>&#39;,&#39;</text>`))
+	assert(t, strings.Contains(svg, `>followed by</text>`))
+	assert(t, strings.Contains(svg, `>not followed by</text>`))
+
+	b.Reset()
+	WriteRailroadSVG(&b, p, "LIST")
+	assert(t, strings.Contains(b.String(), `<title>LIST(X)</title>`))
+	assert(t, strings.Contains(b.String(), `<rect class="param"`))
+
+	b.Reset()
+	WriteRailroadSVG(&b, p, "NUMBER")
+	assert(t, strings.Contains(b.String(), `>token</text>`))
+	assert(t, strings.Contains(b.String(), `>[0-9]</text>`))
+
+	assert(t, WriteRailroadSVG(&b, p, "UNKNOWN") != nil)
+}
+
+func TestRailroadHTML(t *testing.T) {
+	p, _ := NewParser(diagramGrammar)
+
+	var b bytes.Buffer
+	if err := WriteRailroadHTML(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	wellFormed(t, out)
+
+	assert(t, strings.Count(out, "<svg ") == 6)
+	assert(t, strings.Contains(out, `<h2 id="rule-ROOT">ROOT</h2>`))
+	assert(t, strings.Contains(out, `<h2 id="rule-%25whitespace">%whitespace</h2>`))
+	assert(t, strings.Contains(out, `<a href="#rule-ITEM">`))
+	assert(t, strings.Index(out, "rule-ROOT") < strings.Index(out, "rule-ITEM"))
+}
+
+func TestRailroadSize(t *testing.T) {
+	ch := rrChoice{newRRBox("a", "terminal", ""), rrSkip{}, newRRBox("bcd", "terminal", "")}
+	w, up, down := ch.size()
+	assert(t, w == 44+2*rrRail)
+	assert(t, up == 12)
+	assert(t, ch.offsets()[1] == 22 && ch.offsets()[2] == 44)
+	assert(t, down == 56)
+
+	lp := rrLoop{newRRBox("a", "terminal", "")}
+	w, up, down = lp.size()
+	assert(t, w == 28+2*rrRail && up == 12 && down == 22)
+}
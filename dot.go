@@ -0,0 +1,234 @@
+package peg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ruleGraph is the graph of the references between the rules of a grammar.
+type ruleGraph struct {
+	names []string
+	refs  map[string][]string        // Rules referenced by each rule
+	left  map[string]map[string]bool // References in left position, tried before any input is consumed
+}
+
+func newRuleGraph(p *Parser) *ruleGraph {
+	g := &ruleGraph{
+		names: startFirst(p.RuleNames(), p.start),
+		refs:  make(map[string][]string),
+		left:  make(map[string]map[string]bool),
+	}
+	a := newGrammarAnalysis()
+	for _, name := range g.names {
+		r := p.Grammar[name]
+		seen := make(map[string]bool)
+		WalkFunc(r.Ope, func(ope Operator) bool {
+			node := Inspect(ope)
+			if (node.Kind == ReferenceNode || node.Kind == RuleNode) && node.rule != nil && !seen[node.rule.Name] {
+				seen[node.rule.Name] = true
+				g.refs[name] = append(g.refs[name], node.rule.Name)
+			}
+			return node.Kind != RuleNode
+		})
+		g.left[name] = make(map[string]bool)
+		g.leftRefs(a, r.Ope, g.left[name])
+	}
+	return g
+}
+
+// leftRefs adds the rules referenced in left position in ope to refs, and
+// returns whether ope may match without consuming input.
+func (g *ruleGraph) leftRefs(a *grammarAnalysis, ope Operator, refs map[string]bool) bool {
+	node := Inspect(ope)
+	switch node.Kind {
+	case SequenceNode:
+		for _, o := range node.Opes {
+			if !g.leftRefs(a, o, refs) {
+				return false
+			}
+		}
+		return true
+	case ChoiceNode:
+		nullable := false
+		for _, o := range node.Opes {
+			if g.leftRefs(a, o, refs) {
+				nullable = true
+			}
+		}
+		return nullable
+	case ZeroOrMoreNode, OptionNode, AndPredicateNode, NotPredicateNode:
+		g.leftRefs(a, node.Opes[0], refs)
+		return true
+	case OneOrMoreNode, TokenBoundaryNode, IgnoreNode, WhitespaceNode, ExpressionNode:
+		g.leftRefs(a, node.Opes[0], refs)
+		return a.nullable(ope, nil)
+	case ReferenceNode, RuleNode:
+		if node.rule != nil {
+			refs[node.rule.Name] = true
+		}
+		return a.nullable(ope, nil)
+	}
+	return a.nullable(ope, nil)
+}
+
+// components returns the index of the strongly connected component of each
+// rule over the edges for which follow returns true, and the number of rules
+// in each component.
+func (g *ruleGraph) components(follow func(from, to string) bool) (comp map[string]int, size []int) {
+	// Tarjan's algorithm
+	comp = make(map[string]int)
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, ref := range g.refs[name] {
+			if !follow(name, ref) {
+				continue
+			}
+			if _, ok := index[ref]; !ok {
+				visit(ref)
+				if low[ref] < low[name] {
+					low[name] = low[ref]
+				}
+			} else if onStack[ref] && index[ref] < low[name] {
+				low[name] = index[ref]
+			}
+		}
+
+		if low[name] == index[name] {
+			n := 0
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				comp[top] = len(size)
+				n++
+				if top == name {
+					break
+				}
+			}
+			size = append(size, n)
+		}
+	}
+
+	for _, name := range g.names {
+		if _, ok := index[name]; !ok {
+			visit(name)
+		}
+	}
+	return
+}
+
+// cycleEdges returns a function reporting whether an edge followed by follow
+// is part of a cycle of such edges.
+func (g *ruleGraph) cycleEdges(follow func(from, to string) bool) func(from, to string) bool {
+	comp, size := g.components(follow)
+	return func(from, to string) bool {
+		if !follow(from, to) || comp[from] != comp[to] {
+			return false
+		}
+		return from == to || size[comp[from]] > 1
+	}
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// WriteGrammarDOT writes the graph of the references between the rules of
+// the grammar in the DOT language of Graphviz. The start rule has a double
+// border and macros are filled. References that are part of a recursive cycle
+// are bold, and red if the cycle is left recursive, which is only possible if
+// the rules were changed after the grammar was loaded.
+func WriteGrammarDOT(w io.Writer, p *Parser) error {
+	g := newRuleGraph(p)
+	recursive := g.cycleEdges(func(from, to string) bool { return true })
+	leftRecursive := g.cycleEdges(func(from, to string) bool { return g.left[from][to] })
+
+	var b bytes.Buffer
+	b.WriteString("digraph grammar {\n")
+	b.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for _, name := range g.names {
+		r := p.Grammar[name]
+		var attrs []string
+		if r.Parameters != nil {
+			attrs = append(attrs, "label="+dotQuote(ruleHead(r)), `style=filled`, `fillcolor="#dbeafe"`)
+		}
+		if name == p.start {
+			attrs = append(attrs, "peripheries=2")
+		}
+		for _, ref := range g.refs[name] {
+			if leftRecursive(name, ref) {
+				attrs = append(attrs, "color=red", "fontcolor=red")
+				break
+			}
+		}
+		fmt.Fprintf(&b, "  %s", dotQuote(name))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	for _, name := range g.names {
+		for _, ref := range g.refs[name] {
+			fmt.Fprintf(&b, "  %s -> %s", dotQuote(name), dotQuote(ref))
+			switch {
+			case leftRecursive(name, ref):
+				b.WriteString(` [color=red, style=bold, tooltip="left recursion"]`)
+			case recursive(name, ref):
+				b.WriteString(` [style=bold, tooltip="recursion"]`)
+			}
+			b.WriteString(";\n")
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteAstDOT writes the AST in the DOT language of Graphviz. Tokens are
+// shown under the name of their node.
+func WriteAstDOT(w io.Writer, ast *Ast) error {
+	var b bytes.Buffer
+	b.WriteString("digraph ast {\n")
+	b.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+
+	id := 0
+	var write func(ast *Ast) int
+	write = func(ast *Ast) int {
+		n := id
+		id++
+		label := ast.Name
+		if len(ast.Token) > 0 {
+			label += "\n" + strconv.Quote(ast.Token)
+			fmt.Fprintf(&b, "  n%d [label=%s, shape=ellipse];\n", n, dotQuote(label))
+		} else {
+			fmt.Fprintf(&b, "  n%d [label=%s];\n", n, dotQuote(label))
+		}
+		for _, node := range ast.Nodes {
+			fmt.Fprintf(&b, "  n%d -> n%d;\n", n, write(node))
+		}
+		return n
+	}
+	write(ast)
+	b.WriteString("}\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
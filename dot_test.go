@@ -0,0 +1,82 @@
+package peg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGrammarDOT(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT    <- LIST(ITEM) / '(' ROOT ')'
+        LIST(X) <- X (',' X)*
+        ITEM    <- < [a-z]+ >
+    `)
+
+	var b bytes.Buffer
+	if err := WriteGrammarDOT(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph grammar {
+  node [shape=box, fontname="monospace"];
+  "ROOT" [peripheries=2];
+  "LIST" [label="LIST(X)", style=filled, fillcolor="#dbeafe"];
+  "ITEM";
+  "ROOT" -> "LIST";
+  "ROOT" -> "ITEM";
+  "ROOT" -> "ROOT" [style=bold, tooltip="recursion"];
+}
+`
+	if b.String() != expected {
+		t.Errorf("unexpected graph:\n%s", b.String())
+	}
+}
+
+func TestGrammarDOTLeftRecursion(t *testing.T) {
+	p, _ := NewParser(`
+        A <- B 'a' / 'x'
+        B <- 'b'
+    `)
+	// Left recursion can't be loaded, but can be made by changing a rule
+	p.Grammar["B"].Ope = Seq(Opt(Lit("b")), p.Grammar["A"])
+
+	var b bytes.Buffer
+	WriteGrammarDOT(&b, p)
+	out := b.String()
+	assert(t, strings.Contains(out, `"A" [peripheries=2, color=red, fontcolor=red];`))
+	assert(t, strings.Contains(out, `"A" -> "B" [color=red, style=bold, tooltip="left recursion"];`))
+	assert(t, strings.Contains(out, `"B" -> "A" [color=red, style=bold, tooltip="left recursion"];`))
+}
+
+func TestAstDOT(t *testing.T) {
+	p, _ := NewParser(`
+        EXPR   <- NUMBER (OP NUMBER)*
+        OP     <- < [+"] >
+        NUMBER <- < [0-9]+ >
+        %whitespace <- [ ]*
+    `)
+	p.EnableAst()
+	val, err := p.ParseAndGetValue(`1 " 2`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteAstDOT(&b, val.(*Ast)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph ast {
+  node [shape=box, fontname="monospace"];
+  n0 [label="EXPR"];
+  n1 [label="NUMBER\n\"1\"", shape=ellipse];
+  n0 -> n1;
+  n2 [label="OP\n\"\\\"\"", shape=ellipse];
+  n0 -> n2;
+  n3 [label="NUMBER\n\"2\"", shape=ellipse];
+  n0 -> n3;
+}
+`
+	if b.String() != expected {
+		t.Errorf("unexpected graph:\n%s", b.String())
+	}
+}
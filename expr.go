@@ -14,8 +14,8 @@ type BinOpeInfo map[string]struct {
 // Expression parsing
 type expression struct {
 	opeBase
-	atom   operator
-	binop  operator
+	atom   Operator
+	binop  Operator
 	bopinf BinOpeInfo
 	action *Action
 }
@@ -29,16 +29,22 @@ func (o *expression) parseExpr(s string, p int, v *Values, c *context, d Any, mi
 	var tok string
 	r := o.binop.(*reference).rule
 	action := r.Action
+	trial := c.noActions
 	r.Action = func(v *Values, d Any) (val Any, err error) {
 		tok = v.Token()
-		if action != nil {
+		if action != nil && !trial {
 			val, err = action(v, d)
 		} else if len(v.Vs) > 0 {
 			val = v.Vs[0]
 		}
 		return val, err
 	}
-	defer func() { r.Action = action }()
+	trialAction := r.trialAction
+	r.trialAction = true // The operator is read even in trial parses
+	defer func() {
+		r.Action = action
+		r.trialAction = trialAction
+	}()
 
 	saveErrorPos := c.errorPos
 
@@ -83,7 +89,7 @@ func (o *expression) parseExpr(s string, p int, v *Values, c *context, d Any, mi
 		l += chl
 
 		var val Any
-		if *o.action != nil {
+		if *o.action != nil && !c.noActions {
 			v.S = s[p : p+l]
 			v.Pos = p
 
@@ -105,6 +111,9 @@ func (o *expression) parseExpr(s string, p int, v *Values, c *context, d Any, mi
 
 		v.Vs = []Any{val}
 	}
+	if p+l == len(s) {
+		c.hitEnd = true
+	}
 
 	return
 }
@@ -118,7 +127,7 @@ func (o *expression) accept(v visitor) {
 	v.visitExpression(o)
 }
 
-func Exp(atom operator, binop operator, bopinf BinOpeInfo, action *Action) operator {
+func Exp(atom Operator, binop Operator, bopinf BinOpeInfo, action *Action) Operator {
 	o := &expression{atom: atom, binop: binop, bopinf: bopinf, action: action}
 	o.derived = o
 	return o
@@ -0,0 +1,279 @@
+package peg
+
+import "strings"
+
+// FormatGrammar returns the canonical layout of a grammar text. Definitions
+// are written with '<-' arrows aligned within blocks of consecutive
+// definitions, expressions are normalized like PrintOperator does, and
+// comments are kept. A comment inside an expression stays in front of the
+// operator following it, and ends its line. A choice written over several
+// lines keeps one alternative per line, with the slashes aligned under the
+// arrow and the comment lines between alternatives above the next one.
+func FormatGrammar(src string) (string, error) {
+	data := newData()
+	if _, _, err := rStart.Parse(src, data); err != nil {
+		return "", err
+	}
+
+	end := len(src)
+	if data.separatorPos != -1 {
+		end = data.separatorPos
+	}
+
+	f := &formatter{src: src, data: data}
+	for i, r := range data.defs {
+		defEnd := end
+		if i+1 < len(data.defs) {
+			defEnd = data.defs[i+1].Pos
+		}
+		f.addComments(r.Pos)
+		f.addDefinition(r, defEnd)
+	}
+	f.addComments(end)
+
+	f.flush()
+
+	out := strings.Join(trimBlankLines(f.lines), "\n") + "\n"
+	if data.separatorPos != -1 {
+		out += formatOptions(src[data.separatorPos:])
+	}
+	return out, nil
+}
+
+type formatter struct {
+	src   string
+	data  *data
+	pos   int // End of the text formatted so far
+	lines []string
+
+	// Definitions and comments since the last blank line. The definitions
+	// are aligned together.
+	block []blockEntry
+}
+
+type blockEntry struct {
+	def     *formattedDef
+	comment string
+}
+
+type formattedDef struct {
+	head     string
+	alts     []string
+	comments []string   // Trailing comment of each alternative
+	above    [][]string // Comment lines above each alternative
+}
+
+// newlines returns the number of line breaks between the text formatted so
+// far and pos.
+func (f *formatter) newlines(pos int) int {
+	return strings.Count(f.src[f.pos:pos], "\n")
+}
+
+// addComments adds the comments up to end as lines, keeping single blank
+// lines.
+func (f *formatter) addComments(end int) {
+	for _, c := range f.data.commentsIn(f.pos, end) {
+		if f.newlines(c.pos) > 1 {
+			f.blankLine()
+		}
+		f.block = append(f.block, blockEntry{comment: f.src[c.pos:c.end]})
+		f.pos = c.end
+	}
+	if f.newlines(end) > 1 {
+		f.blankLine()
+	}
+	f.pos = end
+}
+
+func (f *formatter) blankLine() {
+	f.flush()
+	if len(f.lines) > 0 && f.lines[len(f.lines)-1] != "" {
+		f.lines = append(f.lines, "")
+	}
+}
+
+// addDefinition adds the definition r ending before end. The comments in its
+// expression are written in place, and a comment after it on the same line
+// belongs to it. The other comments are left to addComments.
+func (f *formatter) addDefinition(r *Rule, end int) {
+	codeEnd := f.data.codeEnd(f.src, r.Pos, end)
+	pr := &printer{src: f.src, comments: f.data.commentsIn(r.Pos, codeEnd), starts: f.data.starts}
+
+	f.pos = codeEnd
+	var trailing []string
+	if cs := f.data.commentsIn(codeEnd, end); len(cs) > 0 && f.newlines(cs[0].pos) == 0 {
+		trailing = append(trailing, f.src[cs[0].pos:cs[0].end])
+		f.pos = cs[0].end
+	}
+
+	def := &formattedDef{head: ruleHead(r)}
+	if cho, ok := r.Ope.(*prioritizedChoice); ok && f.multiline(cho) {
+		var above []string
+		for i, o := range cho.opes {
+			pr.buf.Reset()
+			pr.print(o, precSequence)
+			def.above = append(def.above, above)
+			above = nil
+
+			// The comments left in this alternative and a comment on the line
+			// of its end end the line. The comments on their own lines go
+			// above the next alternative.
+			var cs []string
+			if i+1 < len(cho.opes) {
+				next := f.data.starts[cho.opes[i+1]]
+				end := f.data.starts[o]
+				if span, ok := f.data.spans[o]; ok {
+					end = span.end
+				}
+				for len(pr.comments) > 0 && pr.comments[0].pos < next {
+					c := pr.comments[0]
+					pr.comments = pr.comments[1:]
+					if c.pos < end || (len(above) == 0 && !strings.Contains(f.src[end:c.pos], "\n")) {
+						cs = append(cs, f.src[c.pos:c.end])
+					} else {
+						above = append(above, f.src[c.pos:c.end])
+					}
+				}
+			} else {
+				cs = append(pr.commentsBefore(codeEnd), trailing...)
+			}
+			def.alts = append(def.alts, pr.buf.String())
+			def.comments = append(def.comments, strings.Join(cs, " "))
+		}
+	} else {
+		pr.print(r.Ope, precChoice)
+		def.alts = []string{pr.buf.String()}
+		def.comments = []string{strings.Join(append(pr.commentsBefore(codeEnd), trailing...), " ")}
+		def.above = [][]string{nil}
+	}
+	f.block = append(f.block, blockEntry{def: def})
+}
+
+// multiline reports whether an alternative of a choice starts on another line
+// than the previous one.
+func (f *formatter) multiline(cho *prioritizedChoice) bool {
+	for i := 1; i < len(cho.opes); i++ {
+		prev, ok1 := f.data.starts[cho.opes[i-1]]
+		pos, ok2 := f.data.starts[cho.opes[i]]
+		if ok1 && ok2 && strings.Contains(f.src[prev:pos], "\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// flush writes the pending block.
+func (f *formatter) flush() {
+	width := 0
+	for _, e := range f.block {
+		if e.def != nil {
+			if n := len([]rune(e.def.head)); n > width {
+				width = n
+			}
+		}
+	}
+
+	// Lines broken by comments inside an alternative continue under it
+	indent := "\n" + strings.Repeat(" ", width+len(" <- "))
+
+	for _, e := range f.block {
+		if e.def == nil {
+			f.lines = append(f.lines, e.comment)
+			continue
+		}
+		for i, alt := range e.def.alts {
+			for _, c := range e.def.above[i] {
+				f.lines = append(f.lines, strings.Repeat(" ", width+1)+c)
+			}
+			var line string
+			if i == 0 {
+				line = padRight(e.def.head, width) + " <- "
+			} else {
+				line = strings.Repeat(" ", width) + " / "
+			}
+			line += strings.Replace(alt, "\n", indent, -1)
+			if e.def.comments[i] != "" {
+				line += "  " + e.def.comments[i]
+			}
+			for _, l := range strings.Split(line, "\n") {
+				f.lines = append(f.lines, strings.TrimRight(l, " "))
+			}
+		}
+	}
+	f.block = nil
+}
+
+// trimBlankLines removes blank lines at the beginning and the end.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// formatOptions formats the options section starting with the separator.
+func formatOptions(s string) string {
+	type option struct {
+		name, value, comment string
+	}
+
+	var entries []*option
+	var comments []string // Comment lines in front of entries, and after the last one
+	pending := []string{}
+	width := 0
+
+	s = strings.TrimPrefix(s, "---")
+	for _, line := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(pending) > 0 && pending[len(pending)-1] != "" {
+				pending = append(pending, "")
+			}
+			continue
+		}
+		if line[0] == '#' {
+			pending = append(pending, line)
+			continue
+		}
+
+		opt := &option{}
+		eq := strings.Index(line, "=")
+		opt.name = strings.TrimSpace(line[:eq])
+		opt.value = line[eq+1:]
+		if i := strings.Index(opt.value, "#"); i != -1 {
+			opt.comment = opt.value[i:]
+			opt.value = opt.value[:i]
+		}
+		opt.value = strings.TrimSpace(opt.value)
+		if n := len(opt.name); n > width {
+			width = n
+		}
+
+		comments = append(comments, strings.Join(pending, "\n"))
+		pending = pending[:0]
+		entries = append(entries, opt)
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	for i, opt := range entries {
+		if comments[i] != "" {
+			b.WriteString(comments[i])
+			b.WriteString("\n")
+		}
+		line := padRight(opt.name, width) + " = " + opt.value
+		if opt.comment != "" {
+			line += "  " + opt.comment
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if rest := strings.TrimSpace(strings.Join(pending, "\n")); rest != "" {
+		b.WriteString(rest)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
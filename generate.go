@@ -0,0 +1,453 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GenerateGo writes Go source code of package pkg that builds the parser of
+// the grammar of p without parsing PEG text or checking the grammar at
+// runtime. The code defines a function with the given name returning
+// (*peg.Parser, error), and one parse function per rule, specialized for the
+// operators of the rule. Actions are attached to the returned parser as usual.
+//
+// The parse functions call rules, literals, macros and whitespace through
+// peg.Context, so observers and tracers see those only. The rule of the %expr
+// option and macros are parsed by their operator trees, like with NewParser.
+func GenerateGo(w io.Writer, p *Parser, pkg string, funcName string) error {
+	names := startFirst(p.RuleNames(), p.start)
+
+	idents := make(map[string]string)
+	used := make(map[string]bool)
+	for _, name := range names {
+		id := goIdent(name)
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s%d", goIdent(name), i)
+		}
+		used[id] = true
+		idents[name] = id
+	}
+
+	exprName, _ := getExpressionParsingOptions(p.options)
+	typeName := strings.ToLower(funcName[:1]) + funcName[1:] + "Rules"
+
+	// Parse functions
+	var funcs bytes.Buffer
+	g := &goParseGenerator{rules: idents, opeIndex: make(map[string]int)}
+	for _, name := range names {
+		r := p.Grammar[name]
+		if r.Parameters != nil || name == exprName {
+			continue
+		}
+
+		g.buf.Reset()
+		l := g.gen(r.Ope, "p", "v")
+		if g.err != nil {
+			return errors.New("'" + name + "' " + g.err.Error())
+		}
+
+		fmt.Fprintf(&funcs, "\n// %s <- %s\n", ruleHead(r), strings.Replace(PrintOperator(r.Ope), "\n", `\n`, -1))
+		fmt.Fprintf(&funcs, "func (g *%s) parse%s(c peg.Context, s string, p int, v *peg.Values, d peg.Any) int {\n", typeName, idents[name])
+		funcs.Write(g.buf.Bytes())
+		fmt.Fprintf(&funcs, "return %s\n", l)
+		fmt.Fprintf(&funcs, "}\n")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by peglint gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import peg %q\n\n", "github.com/yhirose/go-peg")
+
+	fmt.Fprintf(&b, "// %s returns the parser of the grammar.\n", funcName)
+	fmt.Fprintf(&b, "func %s() (*peg.Parser, error) {\n", funcName)
+	fmt.Fprintf(&b, "b := peg.NewGrammarBuilder()\n")
+	fmt.Fprintf(&b, "g := &%s{}\n", typeName)
+	for _, name := range names {
+		r := p.Grammar[name]
+		head := name
+		if r.Ignore {
+			head = "~" + head
+		}
+		switch {
+		case r.Parameters != nil:
+			fmt.Fprintf(&b, "g.r%s = b.Macro(%q, %#v, describe%s())\n", idents[name], head, r.Parameters, idents[name])
+		case name == exprName:
+			fmt.Fprintf(&b, "g.r%s = b.Rule(%q, describe%s())\n", idents[name], head, idents[name])
+		default:
+			fmt.Fprintf(&b, "g.r%s = b.Func(%q, g.parse%s, describe%s)\n", idents[name], head, idents[name], idents[name])
+		}
+	}
+	for i, ope := range g.opes {
+		fmt.Fprintf(&b, "g.ope%d = b.Operator(%s)\n", i+1, ope)
+	}
+	for _, name := range optionNames(p.options) {
+		for _, val := range p.options[name] {
+			fmt.Fprintf(&b, "b.Option(%q, %q)\n", name, val)
+		}
+	}
+	fmt.Fprintf(&b, "return b.Link()\n")
+	fmt.Fprintf(&b, "}\n\n")
+
+	fmt.Fprintf(&b, "// %s holds the rules and the operators called by the parse functions.\n", typeName)
+	fmt.Fprintf(&b, "type %s struct {\n", typeName)
+	for _, name := range names {
+		fmt.Fprintf(&b, "r%s *peg.Rule\n", idents[name])
+	}
+	for i := range g.opes {
+		fmt.Fprintf(&b, "ope%d peg.Operator\n", i+1)
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	b.Write(funcs.Bytes())
+
+	// Operator trees
+	for _, name := range names {
+		r := p.Grammar[name]
+		og := &goGenerator{}
+		og.gen(r.Ope)
+		if og.err != nil {
+			return errors.New("'" + name + "' " + og.err.Error())
+		}
+
+		fmt.Fprintf(&b, "\nfunc describe%s() peg.Operator {\n", idents[name])
+		fmt.Fprintf(&b, "return %s\n", og.buf.String())
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goIdent turns a rule name into a part of a Go identifier.
+func goIdent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// goParseGenerator writes the statements of parse functions.
+type goParseGenerator struct {
+	buf   bytes.Buffer
+	n     int               // Number of variables
+	rules map[string]string // Identifiers of the rules
+	err   error
+
+	// Go expressions of the operators passed to Context.Match
+	opes     []string
+	opeIndex map[string]int
+}
+
+func (g *goParseGenerator) newVar(prefix string) string {
+	g.n++
+	return fmt.Sprintf("%s%d", prefix, g.n)
+}
+
+func (g *goParseGenerator) printf(format string, a ...interface{}) {
+	fmt.Fprintf(&g.buf, format, a...)
+}
+
+// match writes the call of an operator of the grammar struct. Operators
+// written the same way are shared.
+func (g *goParseGenerator) match(ope Operator, p, v string) string {
+	og := &goGenerator{}
+	og.gen(ope)
+	i, ok := g.opeIndex[og.buf.String()]
+	if !ok {
+		g.opes = append(g.opes, og.buf.String())
+		i = len(g.opes)
+		g.opeIndex[og.buf.String()] = i
+	}
+	l := g.newVar("l")
+	g.printf("%s := c.Match(g.ope%d, s, %s, %s, d)\n", l, i, p, v)
+	return l
+}
+
+// push writes the statements matching ope with new values, which are
+// dropped, and returns the variable holding the length of the match.
+func (g *goParseGenerator) push(ope Operator, p string) (l string) {
+	chv := g.newVar("v")
+	start := g.buf.Len()
+	g.printf("%s := c.Push()\n", chv)
+	body := g.buf.Len()
+	l = g.gen(ope, p, chv)
+	g.printf("c.Pop()\n")
+
+	// Operators without values, like classes, leave the values unused
+	if !regexp.MustCompile(`\b` + chv + `\b`).Match(g.buf.Bytes()[body:]) {
+		code := append([]byte("c.Push()\n"), g.buf.Bytes()[body:]...)
+		g.buf.Truncate(start)
+		g.buf.Write(code)
+	}
+	return
+}
+
+// gen writes the statements matching ope at p, with the semantic values in
+// v, and returns the variable holding the length of the match. The
+// statements do what the parseCore method of the operator does.
+func (g *goParseGenerator) gen(ope Operator, p, v string) string {
+	node := Inspect(ope)
+
+	switch node.Kind {
+	case SequenceNode:
+		if len(node.Opes) == 1 {
+			return g.gen(node.Opes[0], p, v)
+		}
+		l := g.newVar("l")
+		g.printf("%s := 0\n", l)
+		g.printf("for {\n")
+		for _, o := range node.Opes {
+			chl := g.gen(o, p+"+"+l, v)
+			g.printf("if %s == -1 {\n%s = -1\nbreak\n}\n", chl, l)
+			g.printf("%s += %s\n", l, chl)
+		}
+		g.printf("break\n}\n")
+		return l
+	case ChoiceNode:
+		l := g.newVar("l")
+		g.printf("%s := -1\n", l)
+		g.printf("for {\n")
+		for id, o := range node.Opes {
+			chv := g.newVar("v")
+			g.printf("%s := c.Push()\n", chv)
+			chl := g.gen(o, p, chv)
+			g.printf("c.Pop()\n")
+			g.printf("if %s != -1 {\nc.Choose(%s, %s, %d)\n%s = %s\nbreak\n}\n", chl, v, chv, id, l, chl)
+		}
+		g.printf("break\n}\n")
+		return l
+	case ZeroOrMoreNode:
+		l, saveErrorPos := g.newVar("l"), g.newVar("errorPos")
+		saveVs, saveTs := g.newVar("vs"), g.newVar("ts")
+		g.printf("%s := 0\n", l)
+		g.printf("%s := c.ErrorPos()\n", saveErrorPos)
+		g.printf("for %s+%s < len(s) {\n", p, l)
+		g.printf("%s, %s := %s.Vs, %s.Ts\n", saveVs, saveTs, v, v)
+		chl := g.gen(node.Opes[0], p+"+"+l, v)
+		g.printf("if %s == -1 {\n", chl)
+		g.printf("%s.Vs, %s.Ts = %s, %s\n", v, v, saveVs, saveTs)
+		g.printf("if c.ErrorPos() < %s {\nc.SetErrorPos(%s)\n}\n", saveErrorPos, saveErrorPos)
+		g.printf("break\n}\n")
+		g.printf("%s += %s\n", l, chl)
+		g.printf("}\n")
+		g.printf("if %s+%s == len(s) {\nc.HitEnd()\n}\n", p, l)
+		return l
+	case OneOrMoreNode:
+		l, n, saveErrorPos := g.newVar("l"), g.newVar("n"), g.newVar("errorPos")
+		saveVs, saveTs := g.newVar("vs"), g.newVar("ts")
+		g.printf("%s := 0\n", l)
+		g.printf("%s := -1\n", saveErrorPos)
+		g.printf("for %s := 0; %s == 0 || %s+%s < len(s); %s++ {\n", n, n, p, l, n)
+		g.printf("%s, %s := %s.Vs, %s.Ts\n", saveVs, saveTs, v, v)
+		chl := g.gen(node.Opes[0], p+"+"+l, v)
+		g.printf("if %s == -1 {\n", chl)
+		g.printf("if %s == 0 {\n%s = -1\nbreak\n}\n", n, l)
+		g.printf("%s.Vs, %s.Ts = %s, %s\n", v, v, saveVs, saveTs)
+		g.printf("c.SetErrorPos(%s)\n", saveErrorPos)
+		g.printf("break\n}\n")
+		g.printf("%s += %s\n", l, chl)
+		g.printf("if %s == 0 {\n%s = c.ErrorPos()\n}\n", n, saveErrorPos)
+		g.printf("}\n")
+		g.printf("if %s != -1 && %s+%s == len(s) {\nc.HitEnd()\n}\n", l, p, l)
+		return l
+	case OptionNode:
+		saveErrorPos := g.newVar("errorPos")
+		saveVs, saveTs := g.newVar("vs"), g.newVar("ts")
+		g.printf("%s := c.ErrorPos()\n", saveErrorPos)
+		g.printf("%s, %s := %s.Vs, %s.Ts\n", saveVs, saveTs, v, v)
+		l := g.gen(node.Opes[0], p, v)
+		g.printf("if %s == -1 {\n", l)
+		g.printf("%s.Vs, %s.Ts = %s, %s\n", v, v, saveVs, saveTs)
+		g.printf("c.SetErrorPos(%s)\n", saveErrorPos)
+		g.printf("%s = 0\n}\n", l)
+		return l
+	case AndPredicateNode:
+		chl := g.push(node.Opes[0], p)
+		l := g.newVar("l")
+		g.printf("%s := -1\nif %s != -1 {\n%s = 0\n}\n", l, chl, l)
+		return l
+	case NotPredicateNode:
+		saveErrorPos := g.newVar("errorPos")
+		g.printf("%s := c.ErrorPos()\n", saveErrorPos)
+		chl := g.push(node.Opes[0], p)
+		l := g.newVar("l")
+		g.printf("%s := 0\n", l)
+		g.printf("if %s != -1 {\nc.Fail(%s, \"\")\n%s = -1\n} else {\nc.SetErrorPos(%s)\n}\n", chl, p, l, saveErrorPos)
+		return l
+	case LiteralNode:
+		return g.match(ope, p, v)
+	case ClassNode:
+		l := g.newVar("l")
+		g.printf("%s := -1\n", l)
+		if cond := classCondition(node.Chars); cond != "" {
+			g.printf("if %s < len(s) {\nif ch := s[%s]; %s {\n%s = 1\n}\n} else {\nc.HitEnd()\n}\n", p, p, cond, l)
+		} else {
+			g.printf("if %s == len(s) {\nc.HitEnd()\n}\n", p)
+		}
+		g.printf("if %s == -1 {\nc.Fail(%s, %q)\n}\n", l, p, "["+node.Chars+"]")
+		return l
+	case AnyCharacterNode:
+		l := g.newVar("l")
+		g.printf("%s := -1\n", l)
+		g.printf("if %s < len(s) {\n%s = 1\n} else {\nc.HitEnd()\nc.Fail(%s, %q)\n}\n", p, l, p, "any character")
+		return l
+	case TokenBoundaryNode:
+		g.printf("c.BeginToken()\n")
+		l := g.gen(node.Opes[0], p, v)
+		g.printf("%s = c.EndToken(s, %s, %s, %s, d)\n", l, p, l, v)
+		return l
+	case IgnoreNode:
+		l := g.push(node.Opes[0], p)
+		return l
+	case ReferenceNode, RuleNode:
+		if id, ok := g.rules[node.Name]; ok && node.Args == nil {
+			l := g.newVar("l")
+			g.printf("%s := c.Match(g.r%s, s, %s, %s, d)\n", l, id, p, v)
+			return l
+		}
+		return g.match(ope, p, v)
+	case WhitespaceNode:
+		return g.match(ope, p, v)
+	default:
+		if g.err == nil {
+			g.err = fmt.Errorf("contains an operator of kind %s.", node.Kind)
+			if node.Kind == UserNode {
+				g.err = errors.New("contains a user defined operator.")
+			}
+		}
+		return "-1"
+	}
+}
+
+// classCondition returns the Go expression matching a byte ch with the
+// characters of a class, or an empty string if there are none.
+func classCondition(chars string) string {
+	var conds []string
+	for i := 0; i < len(chars); {
+		if i+2 < len(chars) && chars[i+1] == '-' {
+			conds = append(conds, fmt.Sprintf("%s <= ch && ch <= %s", goByte(chars[i]), goByte(chars[i+2])))
+			i += 3
+		} else {
+			conds = append(conds, "ch == "+goByte(chars[i]))
+			i++
+		}
+	}
+	return strings.Join(conds, " || ")
+}
+
+// goByte returns the Go constant of a byte.
+func goByte(b byte) string {
+	if b < utf8.RuneSelf {
+		return strconv.QuoteRune(rune(b))
+	}
+	return fmt.Sprintf("0x%02x", b)
+}
+
+// goGenerator writes the Go expression constructing an operator.
+type goGenerator struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (g *goGenerator) genList(opes []Operator) {
+	for i, o := range opes {
+		if i > 0 {
+			g.buf.WriteString(", ")
+		}
+		g.gen(o)
+	}
+}
+
+func (g *goGenerator) gen(ope Operator) {
+	node := Inspect(ope)
+
+	unary := func(fn string) {
+		g.buf.WriteString("peg." + fn + "(")
+		g.gen(node.Opes[0])
+		g.buf.WriteString(")")
+	}
+
+	switch node.Kind {
+	case SequenceNode:
+		g.buf.WriteString("peg.Seq(")
+		g.genList(node.Opes)
+		g.buf.WriteString(")")
+	case ChoiceNode:
+		g.buf.WriteString("peg.Cho(")
+		g.genList(node.Opes)
+		g.buf.WriteString(")")
+	case ZeroOrMoreNode:
+		unary("Zom")
+	case OneOrMoreNode:
+		unary("Oom")
+	case OptionNode:
+		unary("Opt")
+	case AndPredicateNode:
+		unary("Apd")
+	case NotPredicateNode:
+		unary("Npd")
+	case TokenBoundaryNode:
+		unary("Tok")
+	case IgnoreNode:
+		unary("Ign")
+	case WhitespaceNode:
+		// Wsp wraps its operand in an ignore
+		if ign := Inspect(node.Opes[0]); ign.Kind == IgnoreNode {
+			g.buf.WriteString("peg.Wsp(")
+			g.gen(ign.Opes[0])
+			g.buf.WriteString(")")
+		} else {
+			g.gen(node.Opes[0])
+		}
+	case LiteralNode:
+		fmt.Fprintf(&g.buf, "peg.Lit(%s)", strconv.Quote(node.Lit))
+	case ClassNode:
+		fmt.Fprintf(&g.buf, "peg.Cls(%s)", strconv.Quote(node.Chars))
+	case AnyCharacterNode:
+		g.buf.WriteString("peg.Dot()")
+	case ReferenceNode:
+		fmt.Fprintf(&g.buf, "peg.Ref(%q, ", node.Name)
+		if node.Args == nil {
+			g.buf.WriteString("nil")
+		} else {
+			g.buf.WriteString("[]peg.Operator{")
+			g.genList(node.Args)
+			g.buf.WriteString("}")
+		}
+		// Positions refer to the grammar text, which the builder doesn't have
+		g.buf.WriteString(", 0)")
+	case RuleNode:
+		fmt.Fprintf(&g.buf, "peg.Ref(%q, nil, 0)", node.Name)
+	case ExpressionNode:
+		// The builder turns it back into an expression with the %expr option
+		g.buf.WriteString("peg.Seq(")
+		g.gen(node.Opes[0])
+		g.buf.WriteString(", peg.Zom(peg.Seq(")
+		g.gen(node.Opes[1])
+		g.buf.WriteString(", ")
+		g.gen(node.Opes[0])
+		g.buf.WriteString(")))")
+	case UserNode:
+		g.buf.WriteString("nil")
+		if g.err == nil {
+			g.err = errors.New("contains a user defined operator.")
+		}
+	}
+}
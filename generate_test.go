@@ -0,0 +1,156 @@
+package peg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const generateTestGrammar = `
+	PROGRAM      <-  (STATEMENT ';')+ !.
+	STATEMENT    <-  'let' NAME '=' EXPR / 'print' LIST(EXPR, ',') / EXPR
+	EXPR         <-  ATOM (BINOP ATOM)*
+	ATOM         <-  NUMBER / STRING / NAME CALL / NAME / '(' EXPR ')'
+	CALL         <-  '(' LIST(EXPR, ',')? ')'
+	BINOP        <-  < [-+/*] >
+	NUMBER       <-  < '-'? [0-9]+ ('.' [0-9]+)? >
+	STRING       <-  < '"' (!'"' .)* '"' >
+	NAME         <-  !KEYWORD &[a-zA-Z_] < [a-zA-Z_] [a-zA-Z_0-9]* >
+	~KEYWORD     <-  ('let' / 'print') ![a-zA-Z_0-9]
+	LIST(I, D)   <-  I (~D I)*
+	%whitespace  <-  [ \t\r\n]*
+	%word        <-  [a-zA-Z_0-9]+
+	---
+	%expr  = EXPR
+	%binop = L + -
+	%binop = L * /
+`
+
+var generateTestCorpus = []string{
+	`1;`,
+	`let x = 1 + 2 * 3; print x, -4.5;`,
+	`f(1, (2 - 3) / 4); g();`,
+	`print "a b", letter;`,
+	"let\ty =\n y;",
+	``,
+	`1`,
+	`1 +;`,
+	`let let = 1;`,
+	`letx = 1;`,
+	`print 1,;`,
+	`f(1;`,
+	`"abc;`,
+	`1.;`,
+	`(1 + 2));`,
+}
+
+func generateTestResults(p *Parser, inputs []string) string {
+	var b strings.Builder
+	for _, s := range inputs {
+		val, err := p.ParseAndGetValue(s, nil)
+		if err != nil {
+			fmt.Fprintf(&b, "%q: %v\n", s, err)
+		} else {
+			fmt.Fprintf(&b, "%q:\n%s", s, val.(*Ast))
+		}
+	}
+	return b.String()
+}
+
+func TestGenerateGo(t *testing.T) {
+	p, err := NewParser(generateTestGrammar)
+	assert(t, err == nil)
+
+	var b bytes.Buffer
+	assert(t, GenerateGo(&b, p, "main", "NewTestParser") == nil)
+	src := b.String()
+
+	for _, s := range []string{
+		`g.rPROGRAM = b.Func("PROGRAM", g.parsePROGRAM, describePROGRAM)`,
+		`g.rEXPR = b.Rule("EXPR", describeEXPR())`,
+		`g.rLIST = b.Macro("LIST", []string{"I", "D"}, describeLIST())`,
+		`g.rKEYWORD = b.Func("~KEYWORD", g.parseKEYWORD, describeKEYWORD)`,
+		`func (g *newTestParserRules) parseNUMBER(c peg.Context, s string, p int, v *peg.Values, d peg.Any) int {`,
+		`return b.Link()`,
+	} {
+		if !strings.Contains(src, s) {
+			t.Errorf("%q not found in:\n%s", s, src)
+		}
+	}
+	if strings.Contains(src, "b.Build()") {
+		t.Errorf("the generated code checks the grammar:\n%s", src)
+	}
+
+	goCmd, err := exec.LookPath("go")
+	if err != nil || testing.Short() {
+		t.Skip("the generated code isn't compiled")
+	}
+
+	// Build the generated code in the module, in a directory the go command
+	// ignores for patterns like ./...
+	dir, err := ioutil.TempDir(".", "_generate")
+	assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	main := fmt.Sprintf(`package main
+
+import (
+	"fmt"
+	"strings"
+
+	peg %q
+)
+
+func main() {
+	p, err := NewTestParser()
+	if err != nil {
+		panic(err)
+	}
+	p.EnableAst()
+	if len(p.Warnings) != 0 {
+		panic("the grammar is linted")
+	}
+
+	var b strings.Builder
+	for _, s := range %#v {
+		val, err := p.ParseAndGetValue(s, nil)
+		if err != nil {
+			fmt.Fprintf(&b, "%%q: %%v\n", s, err)
+		} else {
+			fmt.Fprintf(&b, "%%q:\n%%s", s, val.(*peg.Ast))
+		}
+	}
+	fmt.Print(b.String())
+}
+`, "github.com/yhirose/go-peg", generateTestCorpus)
+
+	assert(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644) == nil)
+	assert(t, ioutil.WriteFile(filepath.Join(dir, "parser.go"), b.Bytes(), 0644) == nil)
+
+	cmd := exec.Command(goCmd, "run", filepath.Join(dir, "main.go"), filepath.Join(dir, "parser.go"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, stderr.String(), src)
+	}
+
+	p.EnableAst()
+	if expected := generateTestResults(p, generateTestCorpus); string(out) != expected {
+		t.Errorf("the generated parser parses differently:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestGenerateGoUserOperator(t *testing.T) {
+	p, _ := NewParserWithUserRules(`START <- 'a' USER`, map[string]Operator{
+		"USER": Usr(func(s string, p int, v *Values, d Any) int { return 0 }),
+	})
+
+	var b bytes.Buffer
+	assert(t, GenerateGo(&b, p, "main", "NewParser") != nil)
+}
@@ -0,0 +1,165 @@
+package peg
+
+import "sort"
+
+// NodeKind is the kind of an operator in a grammar.
+type NodeKind int
+
+const (
+	SequenceNode NodeKind = iota
+	ChoiceNode
+	ZeroOrMoreNode
+	OneOrMoreNode
+	OptionNode
+	AndPredicateNode
+	NotPredicateNode
+	LiteralNode
+	ClassNode
+	AnyCharacterNode
+	TokenBoundaryNode
+	IgnoreNode
+	UserNode
+	ReferenceNode
+	RuleNode
+	WhitespaceNode
+	ExpressionNode
+)
+
+var nodeKindNames = [...]string{
+	SequenceNode:      "Sequence",
+	ChoiceNode:        "Choice",
+	ZeroOrMoreNode:    "ZeroOrMore",
+	OneOrMoreNode:     "OneOrMore",
+	OptionNode:        "Option",
+	AndPredicateNode:  "AndPredicate",
+	NotPredicateNode:  "NotPredicate",
+	LiteralNode:       "Literal",
+	ClassNode:         "Class",
+	AnyCharacterNode:  "AnyCharacter",
+	TokenBoundaryNode: "TokenBoundary",
+	IgnoreNode:        "Ignore",
+	UserNode:          "User",
+	ReferenceNode:     "Reference",
+	RuleNode:          "Rule",
+	WhitespaceNode:    "Whitespace",
+	ExpressionNode:    "Expression",
+}
+
+func (k NodeKind) String() string {
+	if int(k) < len(nodeKindNames) {
+		return nodeKindNames[k]
+	}
+	return "NodeKind(?)"
+}
+
+// Node is a description of an operator. Its slices are copies, so changing
+// them doesn't change the operator.
+type Node struct {
+	Kind NodeKind
+
+	// Operands. Sequences and choices have any number of them, repetitions,
+	// predicates, token boundaries, ignores and whitespace have one, and
+	// expressions have two: the atom and the binary operator.
+	Opes []Operator
+
+	Lit   string // Text of a literal
+	Chars string // Characters of a class, ranges written as 'a-z'
+
+	// Name of a rule, or of the rule or macro parameter a reference refers to
+	Name  string
+	Args  []Operator // Macro arguments of a reference
+	Param bool       // A reference not linked to a rule, like the ones to macro parameters
+	Pos   int        // Position of a rule or reference in the grammar text
+
+	rule *Rule // A rule itself, or the rule a reference is linked to
+}
+
+// Inspect describes an operator.
+func Inspect(ope Operator) Node {
+	v := &nodeInspector{}
+	ope.accept(v)
+	return v.node
+}
+
+// A Visitor's Visit method is invoked for each operator encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the operands of the
+// operator with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(ope Operator) (w Visitor)
+}
+
+// Walk traverses an operator tree in depth-first order. The operands of an
+// operator are visited before the arguments of a reference. References are
+// not followed into the rules they refer to, but a rule is followed into its
+// operator.
+func Walk(v Visitor, ope Operator) {
+	if v = v.Visit(ope); v == nil {
+		return
+	}
+
+	node := Inspect(ope)
+	for _, o := range node.Opes {
+		Walk(v, o)
+	}
+	for _, o := range node.Args {
+		Walk(v, o)
+	}
+
+	v.Visit(nil)
+}
+
+type walkFunc func(ope Operator) bool
+
+func (f walkFunc) Visit(ope Operator) Visitor {
+	if ope != nil && f(ope) {
+		return f
+	}
+	return nil
+}
+
+// WalkFunc traverses an operator tree like Walk and calls f for each operator.
+// The operands of an operator are skipped if f returns false.
+func WalkFunc(ope Operator, f func(ope Operator) bool) {
+	Walk(walkFunc(f), ope)
+}
+
+// Walk walks all rules of the grammar in the order of RuleNames.
+func (p *Parser) Walk(v Visitor) {
+	for _, name := range p.RuleNames() {
+		Walk(v, p.Grammar[name])
+	}
+}
+
+// Start returns the name of the start rule.
+func (p *Parser) Start() string {
+	return p.start
+}
+
+// RuleNames returns the names of the rules in the grammar in the order they
+// are defined. Rules added to Grammar later follow in alphabetical order.
+func (p *Parser) RuleNames() []string {
+	return orderedRuleNames(p.names, p.Grammar)
+}
+
+// orderedRuleNames returns the names of the rules in grammar, the ones in
+// names first.
+func orderedRuleNames(names []string, grammar map[string]*Rule) []string {
+	var ordered []string
+	done := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := grammar[name]; ok && !done[name] {
+			ordered = append(ordered, name)
+			done[name] = true
+		}
+	}
+
+	var rest []string
+	for name := range grammar {
+		if !done[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(ordered, rest...)
+}
@@ -0,0 +1,68 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT       <- ~_ LIST('a', ',') !.
+		LIST(I, D) <- I (D I)*
+		~_         <- < [ \t]* >
+	`)
+
+	assert(t, parser.Start() == "ROOT")
+	assert(t, strings.Join(parser.RuleNames(), " ") == "ROOT LIST _")
+
+	root := Inspect(parser.Grammar["ROOT"])
+	assert(t, root.Kind == RuleNode && root.Name == "ROOT")
+
+	seq := Inspect(root.Opes[0])
+	assert(t, seq.Kind == SequenceNode && len(seq.Opes) == 3)
+	assert(t, Inspect(seq.Opes[0]).Kind == IgnoreNode)
+	assert(t, Inspect(seq.Opes[2]).Kind == NotPredicateNode)
+
+	ref := Inspect(seq.Opes[1])
+	assert(t, ref.Kind == ReferenceNode && ref.Name == "LIST")
+	assert(t, !ref.Param)
+	assert(t, len(ref.Args) == 2 && Inspect(ref.Args[1]).Lit == ",")
+
+	param := Inspect(Inspect(Inspect(parser.Grammar["LIST"]).Opes[0]).Opes[0])
+	assert(t, param.Kind == ReferenceNode && param.Name == "I" && param.Param)
+
+	// The operands are copies
+	seq.Opes[1] = Lit("b")
+	ref.Args[0] = Lit("b")
+	seq = Inspect(root.Opes[0])
+	assert(t, Inspect(seq.Opes[1]).Kind == ReferenceNode)
+	assert(t, Inspect(Inspect(seq.Opes[1]).Args[0]).Lit == "a")
+}
+
+func TestWalk(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT       <- ~_ LIST('a', ',') !.
+		LIST(I, D) <- I (D I)*
+		~_         <- < [ \t]* >
+	`)
+
+	var kinds []string
+	parser.Walk(walkFunc(func(ope Operator) bool {
+		kinds = append(kinds, Inspect(ope).Kind.String())
+		return true
+	}))
+
+	want := "Rule Sequence Ignore Reference Reference Literal Literal NotPredicate AnyCharacter " +
+		"Rule Sequence Reference ZeroOrMore Sequence Reference Reference " +
+		"Rule TokenBoundary ZeroOrMore Class"
+	assert(t, strings.Join(kinds, " ") == want)
+
+	var refs []string
+	WalkFunc(parser.Grammar["LIST"], func(ope Operator) bool {
+		if node := Inspect(ope); node.Kind == ReferenceNode {
+			refs = append(refs, node.Name)
+		}
+		return true
+	})
+	assert(t, strings.Join(refs, " ") == "I D I")
+}
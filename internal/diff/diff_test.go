@@ -0,0 +1,19 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		old, new, expected string
+	}{
+		{"a\n", "a\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\nb\n", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"a\n", "", "--- old\n+++ new\n@@ -1,1 +0,0 @@\n-a\n"},
+	}
+	for _, test := range tests {
+		if d := Unified("old", "new", test.old, test.new); d != test.expected {
+			t.Errorf("diff of %q and %q is:\n%s", test.old, test.new, d)
+		}
+	}
+}
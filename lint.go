@@ -0,0 +1,334 @@
+package peg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Checks of the grammar linter
+const (
+	LintNullableLoop        = "nullable-loop"
+	LintShadowedAlternative = "shadowed-alternative"
+	LintUnusedRule          = "unused-rule"
+	LintUnreachableRule     = "unreachable-rule"
+	LintFailingPredicate    = "failing-predicate"
+)
+
+// LintWarning is a possible problem in a grammar found by Lint. The position
+// is the one of the operator with the problem, or of the definition of the
+// rule for the checks of rules and the grammars not written in PEG text.
+type LintWarning struct {
+	Ln    int
+	Col   int
+	Rule  string
+	Check string
+	Msg   string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%d:%d: %s [%s]", w.Ln, w.Col, w.Msg, w.Check)
+}
+
+// Lint checks a grammar for loops whose body can match an empty string,
+// choice alternatives shadowed by a preceding literal, unused rules, rules
+// unreachable from the start rule and predicates that always fail. NewParser
+// stores the warnings in Parser.Warnings. Macro bodies are checked without
+// knowing their arguments.
+func Lint(p *Parser) (warnings []LintWarning) {
+	a := newGrammarAnalysis()
+
+	var word Operator
+	if r, ok := p.Grammar[WordRuleName]; ok {
+		word = r
+	}
+
+	warn := func(r *Rule, ope Operator, check, msg string) {
+		pos := r.Pos
+		if start, ok := p.starts[ope]; ok {
+			pos = start
+		}
+		ln, col := lineInfo(r.SS, pos)
+		warnings = append(warnings, LintWarning{ln, col, r.Name, check, msg})
+	}
+
+	names := p.RuleNames()
+	for _, name := range names {
+		r := p.Grammar[name]
+		WalkFunc(r.Ope, func(ope Operator) bool {
+			node := Inspect(ope)
+			switch node.Kind {
+			case ZeroOrMoreNode, OneOrMoreNode:
+				if a.nullable(node.Opes[0], nil) {
+					warn(r, ope, LintNullableLoop, fmt.Sprintf("'%s' has a loop whose body can match an empty string: %s", name, PrintOperator(ope)))
+				}
+			case AndPredicateNode:
+				if a.neverSucceeds(node.Opes[0], nil) {
+					warn(r, ope, LintFailingPredicate, fmt.Sprintf("'%s' has a predicate that always fails: %s", name, PrintOperator(ope)))
+				}
+			case NotPredicateNode:
+				if a.alwaysSucceeds(node.Opes[0], nil) {
+					warn(r, ope, LintFailingPredicate, fmt.Sprintf("'%s' has a predicate that always fails: %s", name, PrintOperator(ope)))
+				}
+			case ChoiceNode:
+				for j, alt := range node.Opes {
+					lj, ok := firstLiteral(alt)
+					if !ok {
+						continue
+					}
+					for _, prev := range node.Opes[:j] {
+						li, ok := plainLiteral(prev)
+						if ok && literalShadows(li, lj, word) {
+							warn(r, alt, LintShadowedAlternative, fmt.Sprintf("'%s' has an alternative %s that is never tried, as %s matches first.", name, PrintOperator(alt), PrintOperator(prev)))
+							break
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// References between rules
+	refs := make(map[string][]string)
+	used := make(map[string]bool)
+	for _, name := range names {
+		WalkFunc(p.Grammar[name].Ope, func(ope Operator) bool {
+			if node := Inspect(ope); node.rule != nil && (node.Kind == ReferenceNode || node.Kind == RuleNode) {
+				refs[name] = append(refs[name], node.rule.Name)
+				if node.rule.Name != name {
+					used[node.rule.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	roots := []string{p.start, WhitespceRuleName, WordRuleName}
+	for _, val := range p.options[OptExpressionRule] {
+		roots = append(roots, strings.TrimSpace(val))
+	}
+	reachable := make(map[string]bool)
+	var reach func(name string)
+	reach = func(name string) {
+		if _, ok := p.Grammar[name]; !ok || reachable[name] {
+			return
+		}
+		reachable[name] = true
+		for _, ref := range refs[name] {
+			reach(ref)
+		}
+	}
+	for _, name := range roots {
+		used[name] = true
+		reach(name)
+	}
+
+	for _, name := range names {
+		r := p.Grammar[name]
+		if !used[name] {
+			warn(r, nil, LintUnusedRule, fmt.Sprintf("'%s' is not used.", name))
+		} else if !reachable[name] {
+			warn(r, nil, LintUnreachableRule, fmt.Sprintf("'%s' is not reachable from the start rule '%s'.", name, p.start))
+		}
+	}
+
+	return
+}
+
+// plainLiteral returns the text of a literal, which may be in a token boundary
+// or ignored.
+func plainLiteral(ope Operator) (string, bool) {
+	node := Inspect(ope)
+	switch node.Kind {
+	case LiteralNode:
+		return node.Lit, true
+	case TokenBoundaryNode, IgnoreNode:
+		return plainLiteral(node.Opes[0])
+	}
+	return "", false
+}
+
+// firstLiteral returns the literal an operator starts with.
+func firstLiteral(ope Operator) (string, bool) {
+	node := Inspect(ope)
+	switch node.Kind {
+	case LiteralNode:
+		return node.Lit, true
+	case SequenceNode:
+		if len(node.Opes) > 0 {
+			return firstLiteral(node.Opes[0])
+		}
+	case TokenBoundaryNode, IgnoreNode:
+		return firstLiteral(node.Opes[0])
+	}
+	return "", false
+}
+
+// literalShadows reports whether literal a matches wherever a text starting
+// with b does. With a word rule, a word literal doesn't match when it is
+// followed by more of the word.
+func literalShadows(a, b string, word Operator) bool {
+	if !strings.HasPrefix(b, a) {
+		return false
+	}
+	if word != nil && a != "" {
+		if success(word.parse(a, 0, &Values{}, &context{s: a}, nil)) {
+			if fail(Npd(word).parse(b, len(a), &Values{}, &context{s: b}, nil)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Properties of operators computed by grammarAnalysis
+const (
+	propNullable = iota // Can succeed without consuming input
+	propAlways          // Succeeds on any input
+	propNever           // Fails on any input
+)
+
+// Rule states in grammarAnalysis
+const (
+	ruleUnknown = iota
+	ruleInProgress
+	ruleTrue
+	ruleFalse
+)
+
+// Maximum nesting of macro calls followed by grammarAnalysis
+const maxMacroDepth = 32
+
+// grammarAnalysis computes properties of operators. It is conservative: an
+// operator it can't decide about, like a user defined operator, doesn't have
+// any of the properties.
+type grammarAnalysis struct {
+	rules [3]map[*Rule]int
+}
+
+// Arguments of a macro call
+type macroEnv struct {
+	args  []Operator
+	outer *macroEnv
+	depth int
+}
+
+func newGrammarAnalysis() *grammarAnalysis {
+	a := &grammarAnalysis{}
+	for i := range a.rules {
+		a.rules[i] = make(map[*Rule]int)
+	}
+	return a
+}
+
+func (a *grammarAnalysis) nullable(ope Operator, env *macroEnv) bool {
+	return a.eval(propNullable, ope, env)
+}
+
+func (a *grammarAnalysis) alwaysSucceeds(ope Operator, env *macroEnv) bool {
+	return a.eval(propAlways, ope, env)
+}
+
+func (a *grammarAnalysis) neverSucceeds(ope Operator, env *macroEnv) bool {
+	return a.eval(propNever, ope, env)
+}
+
+func (a *grammarAnalysis) all(prop int, opes []Operator, env *macroEnv) bool {
+	for _, o := range opes {
+		if !a.eval(prop, o, env) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *grammarAnalysis) any(prop int, opes []Operator, env *macroEnv) bool {
+	for _, o := range opes {
+		if a.eval(prop, o, env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *grammarAnalysis) eval(prop int, ope Operator, env *macroEnv) bool {
+	node := Inspect(ope)
+
+	switch node.Kind {
+	case SequenceNode:
+		if prop == propNever {
+			return a.any(prop, node.Opes, env)
+		}
+		return a.all(prop, node.Opes, env)
+	case ChoiceNode:
+		if prop == propNever {
+			return a.all(prop, node.Opes, env)
+		}
+		return a.any(prop, node.Opes, env)
+	case ZeroOrMoreNode, OptionNode:
+		return prop != propNever
+	case AndPredicateNode:
+		if prop == propNullable {
+			return true
+		}
+		return a.eval(prop, node.Opes[0], env)
+	case NotPredicateNode:
+		switch prop {
+		case propNullable:
+			return true
+		case propAlways:
+			return a.eval(propNever, node.Opes[0], env)
+		default:
+			return a.eval(propAlways, node.Opes[0], env)
+		}
+	case LiteralNode:
+		return prop != propNever && node.Lit == ""
+	case ClassNode:
+		return prop == propNever && node.Chars == ""
+	case AnyCharacterNode, UserNode:
+		return false
+	case OneOrMoreNode, TokenBoundaryNode, IgnoreNode, WhitespaceNode, ExpressionNode:
+		return a.eval(prop, node.Opes[0], env)
+	case RuleNode:
+		return a.evalRule(prop, node.rule)
+	case ReferenceNode:
+		if node.rule == nil {
+			// Macro parameter
+			ref, ok := ope.(*reference)
+			if !ok || env == nil || ref.iarg >= len(env.args) {
+				return false
+			}
+			return a.eval(prop, env.args[ref.iarg], env.outer)
+		}
+		if node.rule.Parameters == nil {
+			return a.evalRule(prop, node.rule)
+		}
+		depth := 0
+		if env != nil {
+			depth = env.depth + 1
+		}
+		if depth > maxMacroDepth {
+			return false
+		}
+		return a.eval(prop, node.rule.Ope, &macroEnv{node.Args, env, depth})
+	}
+	return false
+}
+
+func (a *grammarAnalysis) evalRule(prop int, r *Rule) bool {
+	switch a.rules[prop][r] {
+	case ruleTrue:
+		return true
+	case ruleFalse, ruleInProgress:
+		return false
+	}
+
+	a.rules[prop][r] = ruleInProgress
+	ret := a.eval(prop, r.Ope, nil)
+	if ret {
+		a.rules[prop][r] = ruleTrue
+	} else {
+		a.rules[prop][r] = ruleFalse
+	}
+	return ret
+}
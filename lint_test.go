@@ -0,0 +1,118 @@
+package peg
+
+import "testing"
+
+func lintChecks(t *testing.T, grammar string) map[string]string {
+	p, err := NewParser(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make(map[string]string)
+	for _, w := range p.Warnings {
+		checks[w.Rule] = w.Check
+	}
+	return checks
+}
+
+func TestLintNullableLoop(t *testing.T) {
+	checks := lintChecks(t, `
+        ROOT  <- ITEM*
+        ITEM  <- 'a'? ('b' / '')
+    `)
+	assert(t, checks["ROOT"] == LintNullableLoop)
+	assert(t, len(checks) == 1)
+
+	checks = lintChecks(t, `
+        ROOT       <- List('a', ',')
+        List(I, D) <- I (D I)*
+    `)
+	assert(t, len(checks) == 0)
+}
+
+func TestLintShadowedAlternative(t *testing.T) {
+	p, _ := NewParser(`ROOT <- '<' / '<=' / '>' / '>='`)
+	assert(t, len(p.Warnings) == 2)
+	assert(t, p.Warnings[0].Check == LintShadowedAlternative)
+	assert(t, p.Warnings[0].Msg == "'ROOT' has an alternative '<=' that is never tried, as '<' matches first.")
+
+	checks := lintChecks(t, `ROOT <- '<=' / '<' / < '>' > / '>' 'x'`)
+	assert(t, checks["ROOT"] == LintShadowedAlternative)
+
+	checks = lintChecks(t, `ROOT <- '<=' / '<'`)
+	assert(t, len(checks) == 0)
+
+	// A word literal doesn't match in front of more of the word
+	checks = lintChecks(t, `
+        ROOT        <- 'in' / 'int'
+        %whitespace <- [ ]*
+        %word       <- [a-z]+
+    `)
+	assert(t, len(checks) == 0)
+}
+
+func TestLintRules(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT        <- A
+        A           <- 'a' A?
+        B           <- C
+        C           <- 'c' B?
+        D           <- 'd'
+        %whitespace <- [ ]*
+    `)
+	checks := make(map[string]string)
+	for _, w := range p.Warnings {
+		checks[w.Rule] = w.Check
+	}
+	assert(t, len(checks) == 3)
+	assert(t, checks["B"] == LintUnreachableRule)
+	assert(t, checks["C"] == LintUnreachableRule)
+	assert(t, checks["D"] == LintUnusedRule)
+
+	w := p.Warnings[len(p.Warnings)-1]
+	assert(t, w.Ln == 6 && w.Col == 9)
+	assert(t, w.String() == "6:9: 'D' is not used. [unused-rule]")
+}
+
+func TestLintFailingPredicate(t *testing.T) {
+	checks := lintChecks(t, `ROOT <- !'a'? 'b'`)
+	assert(t, checks["ROOT"] == LintFailingPredicate)
+
+	checks = lintChecks(t, `ROOT <- &(!'') 'b'`)
+	assert(t, checks["ROOT"] == LintFailingPredicate)
+
+	checks = lintChecks(t, `ROOT <- !'a' &'b' .`)
+	assert(t, len(checks) == 0)
+}
+
+func TestLintTestGrammars(t *testing.T) {
+	// The warnings of the grammars of the tests, the others are clean
+	expected := map[string]bool{
+		"1:15: 'ROOT' has an alternative '<=' that is never tried, as '<' matches first. [shadowed-alternative]": true,
+		"1:28: 'ROOT' has an alternative '>=' that is never tried, as '>' matches first. [shadowed-alternative]": true,
+		"4:9: 'B' is not reachable from the start rule 'ROOT'. [unreachable-rule]":                               true,
+		"5:9: 'C' is not reachable from the start rule 'ROOT'. [unreachable-rule]":                               true,
+		"6:9: 'D' is not used. [unused-rule]":                                                                    true,
+		"1:10: 'B' is not used. [unused-rule]":                                                                   true,
+		"2:36: 'S' has a predicate that always fails: !'' [failing-predicate]":                                   true,
+		"8:3: 'LIST' is not used. [unused-rule]":                                                                 true,
+	}
+
+	found := make(map[string]bool)
+	for _, grammar := range testGrammars(t) {
+		p, err := NewParser(grammar.text)
+		if err != nil {
+			continue
+		}
+		for _, w := range p.Warnings {
+			if !expected[w.String()] {
+				t.Errorf("unexpected warning %s in:\n%s", w, grammar.text)
+			}
+			found[w.String()] = true
+		}
+	}
+	for w := range expected {
+		if !found[w] {
+			t.Errorf("warning not found: %s", w)
+		}
+	}
+}
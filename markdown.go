@@ -0,0 +1,95 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// docComment returns the comments alone on the lines right before the line of
+// pos in the grammar text s, without the '#' marks and a space after them.
+// comments are the comments of s before pos. A definition that doesn't start
+// its line has no doc comment, and the comments at the top of the text are
+// the header of the grammar rather than the doc comment of the start rule.
+func docComment(s string, pos int, comments []sourceSpan) string {
+	end := strings.LastIndex(s[:pos], "\n") + 1
+	if strings.TrimSpace(s[end:pos]) != "" {
+		return ""
+	}
+
+	var lines []string
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		start := strings.LastIndex(s[:c.pos], "\n") + 1
+		if strings.TrimSpace(s[start:c.pos]) != "" || strings.TrimSpace(s[c.end:end]) != "" || strings.Count(s[c.end:end], "\n") != 1 {
+			break
+		}
+		lines = append(lines, strings.TrimPrefix(s[c.pos+1:c.end], " "))
+		end = start
+	}
+	if strings.TrimSpace(s[:end]) == "" {
+		return ""
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteGrammarMarkdown writes a reference of the grammar in Markdown: a
+// section for each rule, the start rule first, with its doc comment, its PEG
+// definition, and links to the rules it references and the rules using it.
+func WriteGrammarMarkdown(w io.Writer, p *Parser) error {
+	g := newRuleGraph(p)
+	usedBy := make(map[string][]string)
+	for _, name := range g.names {
+		for _, ref := range g.refs[name] {
+			usedBy[ref] = append(usedBy[ref], name)
+		}
+	}
+
+	links := func(names []string) string {
+		var items []string
+		for _, name := range names {
+			items = append(items, fmt.Sprintf("[`%s`](#%s)", name, railroadAnchor(name)))
+		}
+		return strings.Join(items, ", ")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("# Grammar\n\n")
+	for _, name := range g.names {
+		fmt.Fprintf(&b, "- [`%s`](#%s)\n", ruleHead(p.Grammar[name]), railroadAnchor(name))
+	}
+
+	for _, name := range g.names {
+		r := p.Grammar[name]
+		fmt.Fprintf(&b, "\n<a id=\"%s\"></a>\n\n## `%s`\n\n", railroadAnchor(name), ruleHead(r))
+		if name == p.start {
+			b.WriteString("Start rule.\n\n")
+		}
+		if r.Doc != "" {
+			b.WriteString(r.Doc + "\n\n")
+		}
+
+		pr := &printer{}
+		pr.print(r.Ope, precChoice)
+		if pr.err != nil {
+			return errors.New("'" + name + "' " + pr.err.Error())
+		}
+		fmt.Fprintf(&b, "```peg\n%s <- %s\n```\n", ruleHead(r), pr.buf.String())
+
+		if refs := g.refs[name]; len(refs) > 0 {
+			b.WriteString("\nReferences: " + links(refs) + "\n")
+		}
+		if users := usedBy[name]; len(users) > 0 {
+			b.WriteString("\nUsed by: " + links(users) + "\n")
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,131 @@
+package peg
+
+import (
+	"bytes"
+	"testing"
+)
+
+const docGrammar = `# Grammar of lists
+# (not a doc comment: the blank line follows)
+
+# A list of items
+# separated by commas.
+LIST    <- ITEM (',' ITEM)*
+
+#A name or a number
+ITEM    <- NAME / NUMBER
+NAME    <- < [a-z]+ >   # Trailing comments aren't doc comments
+   #   Digits
+NUMBER  <- < [0-9]+ >
+`
+
+func TestRuleDoc(t *testing.T) {
+	p, err := NewParser(docGrammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"LIST", "A list of items\nseparated by commas."},
+		{"ITEM", "A name or a number"},
+		{"NAME", ""},
+		{"NUMBER", "  Digits"},
+	}
+	for _, test := range tests {
+		if doc := p.Grammar[test.name].Doc; doc != test.doc {
+			t.Errorf("%s: doc %q, expected %q", test.name, doc, test.doc)
+		}
+	}
+
+	p, _ = NewParser("A <- 'a' B <- 'b'\n# Not before a definition\n")
+	assert(t, p.Grammar["B"].Doc == "")
+
+	p, _ = NewParser("B <- A\r\n# Windows\r\n# line ends\r\nA <- 'a'\r\n")
+	assert(t, p.Grammar["A"].Doc == "Windows\nline ends")
+
+	// The comments at the top are the header of the grammar
+	p, _ = NewParser("# Header\nA <- B\n# In A\n  B <- 'b'\n")
+	assert(t, p.Grammar["A"].Doc == "")
+	assert(t, p.Grammar["B"].Doc == "In A")
+}
+
+func TestRuleDocPrinted(t *testing.T) {
+	p1, _ := NewParser(docGrammar)
+
+	var b bytes.Buffer
+	assert(t, PrintGrammar(&b, p1) == nil)
+	formatted, err := FormatGrammar(docGrammar)
+	assert(t, err == nil)
+
+	for _, text := range []string{b.String(), formatted} {
+		p2, err := NewParser(text)
+		assert(t, err == nil)
+		for name, r := range p1.Grammar {
+			if doc := p2.Grammar[name].Doc; doc != r.Doc {
+				t.Errorf("%s: doc %q, expected %q in:\n%s", name, doc, r.Doc, text)
+			}
+		}
+	}
+}
+
+func TestGrammarMarkdown(t *testing.T) {
+	p, _ := NewParser(docGrammar)
+
+	var b bytes.Buffer
+	if err := WriteGrammarMarkdown(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	expected := "# Grammar\n" +
+		"\n" +
+		"- [`LIST`](#rule-LIST)\n" +
+		"- [`ITEM`](#rule-ITEM)\n" +
+		"- [`NAME`](#rule-NAME)\n" +
+		"- [`NUMBER`](#rule-NUMBER)\n" +
+		"\n" +
+		"<a id=\"rule-LIST\"></a>\n" +
+		"\n" +
+		"## `LIST`\n" +
+		"\n" +
+		"Start rule.\n" +
+		"\n" +
+		"A list of items\nseparated by commas.\n" +
+		"\n" +
+		"```peg\nLIST <- ITEM (',' ITEM)*\n```\n" +
+		"\n" +
+		"References: [`ITEM`](#rule-ITEM)\n" +
+		"\n" +
+		"<a id=\"rule-ITEM\"></a>\n" +
+		"\n" +
+		"## `ITEM`\n" +
+		"\n" +
+		"A name or a number\n" +
+		"\n" +
+		"```peg\nITEM <- NAME / NUMBER\n```\n" +
+		"\n" +
+		"References: [`NAME`](#rule-NAME), [`NUMBER`](#rule-NUMBER)\n" +
+		"\n" +
+		"Used by: [`LIST`](#rule-LIST)\n" +
+		"\n" +
+		"<a id=\"rule-NAME\"></a>\n" +
+		"\n" +
+		"## `NAME`\n" +
+		"\n" +
+		"```peg\nNAME <- < [a-z]+ >\n```\n" +
+		"\n" +
+		"Used by: [`ITEM`](#rule-ITEM)\n" +
+		"\n" +
+		"<a id=\"rule-NUMBER\"></a>\n" +
+		"\n" +
+		"## `NUMBER`\n" +
+		"\n" +
+		"  Digits\n" +
+		"\n" +
+		"```peg\nNUMBER <- < [0-9]+ >\n```\n" +
+		"\n" +
+		"Used by: [`ITEM`](#rule-ITEM)\n"
+	if b.String() != expected {
+		t.Errorf("unexpected markdown:\n%s", b.String())
+	}
+}
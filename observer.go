@@ -0,0 +1,79 @@
+package peg
+
+// Observer is notified of every operator the parser tries. It can be used to
+// build tools like coverage collectors, profilers and debuggers.
+type Observer interface {
+	// Enter is called before an operator is tried.
+	Enter(ev *ParseEvent)
+
+	// Leave is called after the operator is tried, with the event that was
+	// passed to Enter and Len set.
+	Leave(ev *ParseEvent)
+}
+
+// ParseEvent describes an operator being tried at a position of the input.
+// The methods reporting the state of the parser are only valid during the
+// call of Enter or Leave.
+type ParseEvent struct {
+	Ope    Operator
+	Rule   *Rule // The operator if it is a rule, or nil
+	S      string
+	Pos    int
+	Len    int // Length of the match, or -1 on failure. 0 in Enter.
+	Values *Values
+	Data   Any
+	Depth  int // Number of operators being tried around this one
+
+	c *context
+}
+
+// Success reports whether the operator matched. It is only meaningful in
+// Leave.
+func (ev *ParseEvent) Success() bool {
+	return success(ev.Len)
+}
+
+// ErrorPos returns the farthest position where the parse has failed so far,
+// or -1.
+func (ev *ParseEvent) ErrorPos() int {
+	pos, _ := ev.c.farthestError()
+	return pos
+}
+
+// ExpectedTokens returns the tokens expected at ErrorPos.
+func (ev *ParseEvent) ExpectedTokens() []string {
+	_, tokens := ev.c.farthestError()
+	return tokens
+}
+
+// ValuesStack returns the semantic values of the rules being parsed, the
+// innermost last. The values must not be modified.
+func (ev *ParseEvent) ValuesStack() []Values {
+	return ev.c.svStack
+}
+
+type multiObserver []Observer
+
+func (mo multiObserver) Enter(ev *ParseEvent) {
+	for _, o := range mo {
+		o.Enter(ev)
+	}
+}
+
+func (mo multiObserver) Leave(ev *ParseEvent) {
+	for i := len(mo) - 1; i >= 0; i-- {
+		mo[i].Leave(ev)
+	}
+}
+
+// MultiObserver returns an observer that notifies all the given observers,
+// Leave in reverse order.
+func MultiObserver(observers ...Observer) Observer {
+	var mo multiObserver
+	for _, o := range observers {
+		if o != nil {
+			mo = append(mo, o)
+		}
+	}
+	return mo
+}
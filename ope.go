@@ -58,8 +58,8 @@ func (v *Values) ToBool(i int) bool {
 	return v.Vs[i].(bool)
 }
 
-func (v *Values) ToOpe(i int) operator {
-	return v.Vs[i].(operator)
+func (v *Values) ToOpe(i int) Operator {
+	return v.Vs[i].(Operator)
 }
 
 func (v *Values) Token() string {
@@ -78,18 +78,33 @@ type context struct {
 	message    string
 
 	svStack   []Values
-	argsStack [][]operator
+	argsStack [][]Operator
 
 	inToken bool
 
-	whitespaceOpe operator
+	whitespaceOpe Operator
 	inWhitespace  bool
 
-	wordOpe operator
+	wordOpe Operator
+
+	// Set when an operator wanted to look past the end of s
+	hitEnd bool
+
+	// Set for trial parses, which don't invoke actions and hooks
+	noActions bool
 
 	tracerEnter func(name string, s string, v *Values, d Any, p int)
 	tracerLeave func(name string, s string, v *Values, d Any, p int, l int)
 
+	observer Observer
+	depth    int
+
+	// Results of rules by position, for packrat parsing, and the error
+	// state of the rules around the memoized rules being parsed
+	memo                map[packratKey]*packratResult
+	outerErrorPos       int
+	outerExpectedTokens []string
+
 	// Track expected tokens at error position
 	expectedTokens []string
 }
@@ -123,7 +138,7 @@ func (c *context) pop() {
 	c.svStack = c.svStack[:len(c.svStack)-1]
 }
 
-func (c *context) pushArgs(args []operator) {
+func (c *context) pushArgs(args []Operator) {
 	c.argsStack = append(c.argsStack, args)
 }
 
@@ -131,7 +146,7 @@ func (c *context) popArgs() {
 	c.argsStack = c.argsStack[:len(c.argsStack)-1]
 }
 
-func (c *context) topArg() []operator {
+func (c *context) topArg() []Operator {
 	if len(c.argsStack) == 0 {
 		return nil
 	}
@@ -139,13 +154,27 @@ func (c *context) topArg() []operator {
 }
 
 // parse
-func parse(o operator, s string, p int, v *Values, c *context, d Any) (l int) {
+func parse(o Operator, s string, p int, v *Values, c *context, d Any) (l int) {
 	if c.tracerEnter != nil {
 		c.tracerEnter(o.Label(), s, v, d, p)
 	}
 
+	var ev *ParseEvent
+	if c.observer != nil {
+		ev = &ParseEvent{Ope: o, S: s, Pos: p, Values: v, Data: d, Depth: c.depth, c: c}
+		ev.Rule, _ = o.(*Rule)
+		c.depth++
+		c.observer.Enter(ev)
+	}
+
 	l = o.parseCore(s, p, v, c, d)
 
+	if ev != nil {
+		c.depth--
+		ev.Len = l
+		c.observer.Leave(ev)
+	}
+
 	if c.tracerLeave != nil {
 		c.tracerLeave(o.Label(), s, v, d, p, l)
 	}
@@ -153,7 +182,7 @@ func parse(o operator, s string, p int, v *Values, c *context, d Any) (l int) {
 }
 
 // Operator
-type operator interface {
+type Operator interface {
 	Label() string
 	parse(s string, p int, v *Values, c *context, d Any) int
 	parseCore(s string, p int, v *Values, c *context, d Any) int
@@ -162,7 +191,7 @@ type operator interface {
 
 // Operator base
 type opeBase struct {
-	derived operator
+	derived Operator
 }
 
 func (o *opeBase) Label() string {
@@ -176,7 +205,7 @@ func (o *opeBase) parse(s string, p int, v *Values, c *context, d Any) int {
 // Sequence
 type sequence struct {
 	opeBase
-	opes []operator
+	opes []Operator
 }
 
 func (o *sequence) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -199,7 +228,8 @@ func (o *sequence) accept(v visitor) {
 // Prioritized Choice
 type prioritizedChoice struct {
 	opeBase
-	opes []operator
+	opes   []Operator
+	source *prioritizedChoice // Choice of the grammar copied in a macro argument
 }
 
 func (o *prioritizedChoice) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -229,7 +259,7 @@ func (o *prioritizedChoice) accept(v visitor) {
 // Zero or More
 type zeroOrMore struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *zeroOrMore) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -254,6 +284,9 @@ func (o *zeroOrMore) parseCore(s string, p int, v *Values, c *context, d Any) (l
 		l += chl
 		// fmt.Println("RETUNR ZOM: " + strconv.Itoa(l))
 	}
+	if p+l == len(s) {
+		c.hitEnd = true
+	}
 	return
 }
 
@@ -264,7 +297,7 @@ func (o *zeroOrMore) accept(v visitor) {
 // One or More
 type oneOrMore struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *oneOrMore) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -285,6 +318,9 @@ func (o *oneOrMore) parseCore(s string, p int, v *Values, c *context, d Any) (l
 		}
 		l += chl
 	}
+	if p+l == len(s) {
+		c.hitEnd = true
+	}
 	return
 }
 
@@ -295,7 +331,7 @@ func (o *oneOrMore) accept(v visitor) {
 // Option
 type option struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *option) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -319,7 +355,7 @@ func (o *option) accept(v visitor) {
 // And Predicate
 type andPredicate struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *andPredicate) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -342,7 +378,7 @@ func (o *andPredicate) accept(v visitor) {
 // Not Predicate
 type notPredicate struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *notPredicate) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
@@ -377,6 +413,9 @@ type literalString struct {
 func (o *literalString) parseCore(s string, p int, v *Values, c *context, d Any) int {
 	l := 0
 	for ; l < len(o.lit); l++ {
+		if p+l == len(s) {
+			c.hitEnd = true
+		}
 		if p+l == len(s) || s[p+l] != o.lit[l] {
 			c.setErrorPos(p)
 			c.addExpectedToken(fmt.Sprintf("'%s'", o.lit))
@@ -392,7 +431,11 @@ func (o *literalString) parseCore(s string, p int, v *Values, c *context, d Any)
 		}
 	})
 	if o.isWord {
-		len := Npd(c.wordOpe).parse(s, p+l, v, &context{s: s}, nil)
+		wc := &context{s: s}
+		len := Npd(c.wordOpe).parse(s, p+l, v, wc, nil)
+		if wc.hitEnd {
+			c.hitEnd = true
+		}
 		if fail(len) {
 			return -1
 		}
@@ -425,6 +468,7 @@ type characterClass struct {
 func (o *characterClass) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
 	// TODO: UTF8 support
 	if len(s)-p < 1 {
+		c.hitEnd = true
 		c.setErrorPos(p)
 		c.addExpectedToken(fmt.Sprintf("[%s]", o.chars))
 		l = -1
@@ -465,6 +509,7 @@ type anyCharacter struct {
 func (o *anyCharacter) parseCore(s string, p int, v *Values, c *context, d Any) (l int) {
 	// TODO: UTF8 support
 	if len(s)-p < 1 {
+		c.hitEnd = true
 		c.setErrorPos(p)
 		c.addExpectedToken("any character")
 		l = -1
@@ -481,7 +526,7 @@ func (o *anyCharacter) accept(v visitor) {
 // Token Boundary
 type tokenBoundary struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *tokenBoundary) parseCore(s string, p int, v *Values, c *context, d Any) int {
@@ -510,7 +555,7 @@ func (o *tokenBoundary) accept(v visitor) {
 // Ignore
 type ignore struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *ignore) parseCore(s string, p int, v *Values, c *context, d Any) int {
@@ -531,7 +576,18 @@ type user struct {
 }
 
 func (o *user) parseCore(s string, p int, v *Values, c *context, d Any) int {
-	return o.fn(s, p, v, d)
+	if c.noActions {
+		defer abortTrial()
+	}
+	l := o.fn(s, p, v, d)
+
+	// The function may have looked past a match reaching the end of s, or
+	// failed for lack of input at the end of s. Other failures caused by the
+	// end of s aren't known.
+	if (success(l) && p+l == len(s)) || (fail(l) && p == len(s)) {
+		c.hitEnd = true
+	}
+	return l
 }
 
 func (o *user) accept(v visitor) {
@@ -543,7 +599,7 @@ type reference struct {
 	opeBase
 	name  string
 	iarg  int
-	args  []operator
+	args  []Operator
 	iargs []int
 	pos   int
 	rule  *Rule
@@ -569,7 +625,7 @@ func (o *reference) parseCore(s string, p int, v *Values, c *context, d Any) (l
 			}
 
 			// Collect arguments
-			var args []operator
+			var args []Operator
 			for _, arg := range o.args {
 				arg.accept(vis)
 				args = append(args, vis.ope)
@@ -594,7 +650,7 @@ func (o *reference) accept(v visitor) {
 // Whitespace
 type whitespace struct {
 	opeBase
-	ope operator
+	ope Operator
 }
 
 func (o *whitespace) parseCore(s string, p int, v *Values, c *context, d Any) int {
@@ -612,83 +668,83 @@ func (o *whitespace) accept(v visitor) {
 	v.visitWhitespace(o)
 }
 
-func SeqCore(opes []operator) operator {
+func SeqCore(opes []Operator) Operator {
 	o := &sequence{opes: opes}
 	o.derived = o
 	return o
 }
-func Seq(opes ...operator) operator {
+func Seq(opes ...Operator) Operator {
 	return SeqCore(opes)
 }
-func ChoCore(opes []operator) operator {
+func ChoCore(opes []Operator) Operator {
 	o := &prioritizedChoice{opes: opes}
 	o.derived = o
 	return o
 }
-func Cho(opes ...operator) operator {
+func Cho(opes ...Operator) Operator {
 	return ChoCore(opes)
 }
-func Zom(ope operator) operator {
+func Zom(ope Operator) Operator {
 	o := &zeroOrMore{ope: ope}
 	o.derived = o
 	return o
 }
-func Oom(ope operator) operator {
+func Oom(ope Operator) Operator {
 	o := &oneOrMore{ope: ope}
 	o.derived = o
 	return o
 }
-func Opt(ope operator) operator {
+func Opt(ope Operator) Operator {
 	o := &option{ope: ope}
 	o.derived = o
 	return o
 }
-func Apd(ope operator) operator {
+func Apd(ope Operator) Operator {
 	o := &andPredicate{ope: ope}
 	o.derived = o
 	return o
 }
-func Npd(ope operator) operator {
+func Npd(ope Operator) Operator {
 	o := &notPredicate{ope: ope}
 	o.derived = o
 	return o
 }
-func Lit(lit string) operator {
+func Lit(lit string) Operator {
 	o := &literalString{lit: lit}
 	o.derived = o
 	return o
 }
-func Cls(chars string) operator {
+func Cls(chars string) Operator {
 	o := &characterClass{chars: chars}
 	o.derived = o
 	return o
 }
-func Dot() operator {
+func Dot() Operator {
 	o := &anyCharacter{}
 	o.derived = o
 	return o
 }
-func Tok(ope operator) operator {
+func Tok(ope Operator) Operator {
 	o := &tokenBoundary{ope: ope}
 	o.derived = o
 	return o
 }
-func Ign(ope operator) operator {
+func Ign(ope Operator) Operator {
 	o := &ignore{ope: ope}
 	o.derived = o
 	return o
 }
-func Usr(fn func(s string, p int, v *Values, d Any) int) operator {
+func Usr(fn func(s string, p int, v *Values, d Any) int) Operator {
 	o := &user{fn: fn}
 	o.derived = o
 	return o
 }
-func Ref(ident string, args []operator, pos int) operator {
+func Ref(ident string, args []Operator, pos int) Operator {
 	o := &reference{name: ident, args: args, pos: pos}
 	o.derived = o
 	return o
 }
-func Wsp(ope operator) operator {
+func Wsp(ope Operator) Operator {
 	o := &whitespace{ope: Ign(ope)}
 	o.derived = o
 	return o
@@ -7,7 +7,7 @@ type Cases []struct {
 	want  int
 }
 
-func run(name string, t *testing.T, ope operator, cases Cases) {
+func run(name string, t *testing.T, ope Operator, cases Cases) {
 	for _, cs := range cases {
 		v := &Values{}
 		c := &context{}
@@ -0,0 +1,111 @@
+package peg
+
+// Packrat parsing memoizes the result of each rule at each position of the
+// input, so that backtracking doesn't parse the same text with a rule again:
+// the parse time is linear in the length of the input, at the cost of memory
+// proportional to it. The effects of the parse on the error position, the
+// error message and the end of input flag are memoized with the result, so
+// errors are reported at the same positions as without memoization. Syntax
+// errors may list fewer expected tokens, as the tokens tried at positions
+// before the error aren't added to the ones of a memoized rule.
+//
+// Actions and the Enter and Leave hooks of a rule are invoked once for each
+// position the rule is parsed at, and not again when the result is reused.
+
+// packratKey identifies a parse of a rule at a position. The result of the
+// parse also depends on whether it is inside a token or whitespace.
+type packratKey struct {
+	rule         *Rule
+	pos          int
+	inToken      bool
+	inWhitespace bool
+}
+
+// packratResult is a memoized parse of a rule, with its effects on the
+// context, as if the parse had started with a new context.
+type packratResult struct {
+	l      int
+	val    Any
+	hasVal bool // val is appended to the values of the parent
+
+	errorPos       int
+	expectedTokens []string
+	messagePos     int
+	message        string
+	hitEnd         bool
+}
+
+// parseMemoized parses s at p with r, or reuses the result of an earlier parse
+// at the same position.
+func (c *context) parseMemoized(r *Rule, s string, p int, v *Values, d Any) int {
+	key := packratKey{r, p, c.inToken, c.inWhitespace}
+	res, ok := c.memo[key]
+	if !ok {
+		errorPos, expectedTokens := c.errorPos, c.expectedTokens
+		messagePos, message := c.messagePos, c.message
+		hitEnd := c.hitEnd
+		outerErrorPos, outerExpectedTokens := c.outerErrorPos, c.outerExpectedTokens
+		c.outerErrorPos, c.outerExpectedTokens = c.farthestError()
+		c.errorPos, c.expectedTokens = -1, nil
+		c.messagePos, c.message = -1, ""
+		c.hitEnd = false
+
+		n := len(v.Vs)
+		res = &packratResult{l: r.parseRule(s, p, v, c, d)}
+		if len(v.Vs) > n {
+			res.val, res.hasVal = v.Vs[n], true
+		}
+		res.errorPos, res.expectedTokens = c.errorPos, c.expectedTokens
+		res.messagePos, res.message = c.messagePos, c.message
+		res.hitEnd = c.hitEnd
+		c.memo[key] = res
+
+		c.errorPos, c.expectedTokens = errorPos, expectedTokens
+		c.messagePos, c.message = messagePos, message
+		c.hitEnd = hitEnd
+		c.outerErrorPos, c.outerExpectedTokens = outerErrorPos, outerExpectedTokens
+	} else if res.hasVal {
+		v.Vs = append(v.Vs, res.val)
+	}
+
+	switch {
+	case res.errorPos > c.errorPos:
+		c.errorPos = res.errorPos
+		c.expectedTokens = append([]string(nil), res.expectedTokens...)
+	case res.errorPos == c.errorPos:
+		for _, t := range res.expectedTokens {
+			c.addExpectedToken(t)
+		}
+	}
+	if res.messagePos > c.messagePos {
+		c.messagePos, c.message = res.messagePos, res.message
+	}
+	if res.hitEnd {
+		c.hitEnd = true
+	}
+	return res.l
+}
+
+// farthestError returns the farthest error position of the parse and the
+// tokens expected there, including the rules around the memoized rules being
+// parsed, whose errors are set aside.
+func (c *context) farthestError() (int, []string) {
+	switch {
+	case c.memo == nil || c.outerErrorPos < c.errorPos:
+		return c.errorPos, c.expectedTokens
+	case c.outerErrorPos > c.errorPos:
+		return c.outerErrorPos, c.outerExpectedTokens
+	}
+	merged := &context{expectedTokens: append([]string(nil), c.outerExpectedTokens...)}
+	for _, t := range c.expectedTokens {
+		merged.addExpectedToken(t)
+	}
+	return c.errorPos, merged.expectedTokens
+}
+
+func newMemo(packrat bool) map[packratKey]*packratResult {
+	if !packrat {
+		return nil
+	}
+	return make(map[packratKey]*packratResult)
+}
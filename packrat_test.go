@@ -0,0 +1,111 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackratParsing(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT  <- ITEMS ';' / ITEMS '.'
+		ITEMS <- ITEM (',' ITEM)*
+		ITEM  <- < [a-z]+ >
+		%whitespace <- [ \t]*
+	`)
+
+	calls := 0
+	parser.Grammar["ITEM"].Action = func(v *Values, d Any) (Any, error) {
+		calls++
+		return v.Token(), nil
+	}
+	parser.Grammar["ITEMS"].Action = func(v *Values, d Any) (Any, error) {
+		return strings.Join([]string{v.ToStr(0), v.ToStr(v.Len() - 1)}, "-"), nil
+	}
+
+	val, err := parser.ParseAndGetValue("a, b, c.", nil)
+	assert(t, err == nil)
+	assert(t, val == "a-c")
+	assert(t, calls == 6)
+
+	// ITEMS is parsed once at the beginning
+	parser.PackratEnabled = true
+	calls = 0
+	val, err = parser.ParseAndGetValue("a, b, c.", nil)
+	assert(t, err == nil)
+	assert(t, val == "a-c")
+	assert(t, calls == 3)
+}
+
+func TestPackratParsingBacktracking(t *testing.T) {
+	parser, _ := NewParser(`
+		EXPR   <- TERM '+' EXPR / TERM '-' EXPR / TERM
+		TERM   <- '(' EXPR ')' / NUMBER
+		NUMBER <- < [0-9]+ >
+	`)
+
+	count := &countObserver{}
+	parser.Observer = count
+	input := strings.Repeat("(", 8) + "1" + strings.Repeat(")", 8)
+
+	assert(t, parser.Parse(input, nil) == nil)
+	backtracking := count.enter
+	parser.PackratEnabled = true
+	count.enter = 0
+	assert(t, parser.Parse(input, nil) == nil)
+	assert(t, count.enter*100 < backtracking)
+}
+
+type countObserver struct {
+	enter int
+}
+
+func (o *countObserver) Enter(ev *ParseEvent) { o.enter++ }
+func (o *countObserver) Leave(ev *ParseEvent) {}
+
+func TestPackratParsingErrors(t *testing.T) {
+	parser, _ := NewParser(`
+		ROOT        <- STMT+
+		STMT        <- 'return' EXPR ';' / 'print' '(' LIST ')' ';' / EXPR ';'
+		LIST        <- EXPR (',' EXPR)*
+		EXPR        <- NUMBER / '(' EXPR ')' / NAME
+		NUMBER      <- < [0-9]+ >
+		NAME        <- < [a-z]+ >
+		%whitespace <- [ \t\n]*
+	`)
+	parser.Grammar["NAME"].Message = func() string { return "name expected" }
+
+	inputs := []string{
+		"return 1;",
+		"print(1, 2;",
+		"print(1\n2);",
+		"return (\n  (1",
+		"(a);(b",
+		"%",
+		"",
+	}
+	// The positions of the errors are the same. The expected tokens may not,
+	// as tokens tried at earlier positions are listed without memoization.
+	for _, input := range inputs {
+		parser.PackratEnabled = false
+		_, err := parser.ParseAndGetValue(input, nil)
+		parser.PackratEnabled = true
+		_, perr := parser.ParseAndGetValue(input, nil)
+		if (err == nil) != (perr == nil) {
+			t.Fatalf("%q: %v / %v", input, err, perr)
+		}
+		if err == nil {
+			continue
+		}
+
+		var d, pd ErrorDetail
+		switch e := err.(type) {
+		case *Error:
+			d, pd = e.Details[0], perr.(*Error).Details[0]
+		case *SyntaxError:
+			d, pd = e.BaseError.Details[0], perr.(*SyntaxError).BaseError.Details[0]
+		}
+		if d.Ln != pd.Ln || d.Col != pd.Col {
+			t.Errorf("%q: %v / %v", input, d, pd)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package peg
 
 import (
-	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
 	"strings"
 )
 
@@ -20,16 +23,77 @@ type duplicate struct {
 
 type data struct {
 	grammar    map[string]*Rule
+	names      []string
 	start      string
 	duplicates []duplicate
 	options    map[string][]string
+
+	// All definitions including duplicates, and the position of the options
+	// separator, for the formatter
+	defs         []*Rule
+	separatorPos int
+
+	// Source text of the sequences, which are the alternatives of choices
+	spans map[Operator]sourceSpan
+
+	// Comments in the order of the text, and the positions where the
+	// operators of the definitions start, for the formatter and the linter
+	comments []sourceSpan
+	starts   map[Operator]int
+}
+
+type sourceSpan struct {
+	pos, end int
 }
 
 func newData() *data {
 	return &data{
-		grammar: make(map[string]*Rule),
-		options: make(map[string][]string),
+		grammar:      make(map[string]*Rule),
+		options:      make(map[string][]string),
+		separatorPos: -1,
+		spans:        make(map[Operator]sourceSpan),
+		starts:       make(map[Operator]int),
+	}
+}
+
+// addComment records a comment. A comment is parsed again when the parser
+// backtracks over it, so it is recorded once.
+func (d *data) addComment(pos, end int) {
+	i := sort.Search(len(d.comments), func(i int) bool { return d.comments[i].pos >= pos })
+	if i < len(d.comments) && d.comments[i].pos == pos {
+		return
 	}
+	d.comments = append(d.comments, sourceSpan{})
+	copy(d.comments[i+1:], d.comments[i:])
+	d.comments[i] = sourceSpan{pos, end}
+}
+
+// commentsIn returns the comments starting in s[pos:end].
+func (d *data) commentsIn(pos, end int) []sourceSpan {
+	i := sort.Search(len(d.comments), func(i int) bool { return d.comments[i].pos >= pos })
+	j := sort.Search(len(d.comments), func(i int) bool { return d.comments[i].pos >= end })
+	if i >= j {
+		return nil
+	}
+	return d.comments[i:j]
+}
+
+// codeEnd returns the end of s[pos:end] without the spacing after the
+// grammar text, that is the white spaces and the comments.
+func (d *data) codeEnd(s string, pos, end int) int {
+	for end > pos {
+		switch s[end-1] {
+		case ' ', '\t', '\r', '\n':
+			end--
+			continue
+		}
+		i := sort.Search(len(d.comments), func(i int) bool { return d.comments[i].end >= end })
+		if i == len(d.comments) || d.comments[i].end != end || d.comments[i].pos < pos {
+			break
+		}
+		end = d.comments[i].pos
+	}
+	return end
 }
 
 var rStart, rDefinition, rExpression,
@@ -133,7 +197,7 @@ func init() {
 		var ignore bool
 		var name string
 		var params []string
-		var ope operator
+		var ope Operator
 
 		switch v.Choice {
 		case 0: // Macro
@@ -147,19 +211,24 @@ func init() {
 			ope = v.ToOpe(3)
 		}
 
+		r := &Rule{
+			Ope:        ope,
+			Name:       name,
+			SS:         v.SS,
+			Pos:        v.Pos,
+			Ignore:     ignore,
+			Parameters: params,
+		}
+
 		data := d.(*data)
+		r.Doc = docComment(v.SS, v.Pos, data.commentsIn(0, v.Pos))
+		data.defs = append(data.defs, r)
 		_, ok := data.grammar[name]
 		if ok {
 			data.duplicates = append(data.duplicates, duplicate{name, v.Pos})
 		} else {
-			data.grammar[name] = &Rule{
-				Ope:        ope,
-				Name:       name,
-				SS:         v.SS,
-				Pos:        v.Pos,
-				Ignore:     ignore,
-				Parameters: params,
-			}
+			data.grammar[name] = r
+			data.names = append(data.names, name)
 			if len(data.start) == 0 {
 				data.start = name
 			}
@@ -177,7 +246,7 @@ func init() {
 	}
 
 	rArguments.Action = func(v *Values, d Any) (val Any, err error) {
-		var exprs []operator
+		var exprs []Operator
 		for i := 0; i < len(v.Vs); i++ {
 			exprs = append(exprs, v.ToOpe(i))
 		}
@@ -189,12 +258,13 @@ func init() {
 		if len(v.Vs) == 1 {
 			val = v.ToOpe(0)
 		} else {
-			var opes []operator
+			var opes []Operator
 			for i := 0; i < len(v.Vs); i++ {
 				opes = append(opes, v.ToOpe(i))
 			}
 			val = Cho(opes...)
 		}
+		d.(*data).starts[val.(Operator)] = v.Pos
 		return
 	}
 
@@ -202,12 +272,18 @@ func init() {
 		if len(v.Vs) == 1 {
 			val = v.ToOpe(0)
 		} else {
-			var opes []operator
+			var opes []Operator
 			for i := 0; i < len(v.Vs); i++ {
 				opes = append(opes, v.ToOpe(i))
 			}
 			val = Seq(opes...)
 		}
+
+		// Without the spacing at the end
+		data := d.(*data)
+		end := data.codeEnd(v.SS, v.Pos, v.Pos+len(v.S))
+		data.spans[val.(Operator)] = sourceSpan{v.Pos, end}
+		data.starts[val.(Operator)] = v.Pos
 		return
 	}
 
@@ -224,6 +300,7 @@ func init() {
 				val = Npd(ope)
 			}
 		}
+		d.(*data).starts[val.(Operator)] = v.Pos
 		return
 	}
 
@@ -242,6 +319,7 @@ func init() {
 				val = Oom(ope)
 			}
 		}
+		d.(*data).starts[val.(Operator)] = v.Pos
 		return
 	}
 
@@ -251,9 +329,9 @@ func init() {
 			ignore := v.ToBool(0)
 			ident := v.ToStr(1)
 
-			var args []operator
+			var args []Operator
 			if v.Choice == 0 {
-				args = v.Vs[2].([]operator)
+				args = v.Vs[2].([]Operator)
 			}
 
 			if ignore {
@@ -268,6 +346,7 @@ func init() {
 		default:
 			val = v.ToOpe(0)
 		}
+		d.(*data).starts[val.(Operator)] = v.Pos
 		return
 	}
 
@@ -308,6 +387,11 @@ func init() {
 		return
 	}
 
+	rComment.Action = func(v *Values, d Any) (val Any, err error) {
+		d.(*data).addComment(v.Pos, v.Pos+len(strings.TrimRight(v.S, "\r\n")))
+		return
+	}
+
 	rOption.Action = func(v *Values, d Any) (val Any, err error) {
 		options := d.(*data).options
 		optName := v.ToStr(0)
@@ -315,6 +399,10 @@ func init() {
 		options[optName] = append(options[optName], optVal)
 		return
 	}
+	rSEPARATOR.Action = func(v *Values, d Any) (val Any, err error) {
+		d.(*data).separatorPos = v.Pos
+		return
+	}
 	rOptionValue.Action = func(v *Values, d Any) (Any, error) {
 		return v.Token(), nil
 	}
@@ -465,22 +553,78 @@ func getExpressionParsingOptions(options map[string][]string) (name string, info
 
 // TracingOptions defines the configuration for parser tracing
 type TracingOptions struct {
-	ShowRuleEntry    bool   // Show when entering a rule
-	ShowRuleExit     bool   // Show when exiting a rule
-	ShowTokens       bool   // Show tokens as they are parsed
-	ShowErrorContext bool   // Show context around errors
-	OutputFormat     string // Format for output: "text" or "json"
+	ShowRuleEntry    bool      // Show when entering a rule
+	ShowRuleExit     bool      // Show when exiting a rule
+	ShowTokens       bool      // Show tokens as they are parsed
+	ShowErrorContext bool      // Show context around errors
+	OutputFormat     string    // Format for output: "text" or "json"
+	Output           io.Writer // Writer of the trace, standard output if nil
+	Sink             TraceSink // Receiver of the trace events, instead of Output and OutputFormat
+
+	// Filters applied to the events before they are formatted. The rule of
+	// an event is the innermost rule being parsed, or the operator itself if
+	// it is a rule.
+	IncludeRules         []string // Show only events of rules matching one of these patterns (path.Match)
+	ExcludeRules         []string // Don't show events of rules matching one of these patterns
+	RulesOnly            bool     // Show rules only, not the other operators
+	StartPos             int      // Show only events at positions from StartPos
+	EndPos               int      // Show only events at positions before EndPos, if it isn't 0
+	MaxDepth             int      // Show only events at depths up to MaxDepth, if it isn't 0
+	FarthestFailuresOnly bool     // Show only the failures at the farthest position, when the parse ends
+}
+
+// sink returns the trace sink of the options.
+func (o *TracingOptions) sink() TraceSink {
+	if o.Sink != nil {
+		return o.Sink
+	}
+	w := o.Output
+	if w == nil {
+		w = os.Stdout
+	}
+	if o.OutputFormat == "json" {
+		return NewJSONTraceSink(w)
+	}
+	return NewTextTraceSink(w)
+}
+
+// matchRule reports whether the events of the rule pass the include and
+// exclude filters.
+func (o *TracingOptions) matchRule(name string) bool {
+	if len(o.IncludeRules) > 0 && !matchAny(o.IncludeRules, name) {
+		return false
+	}
+	return !matchAny(o.ExcludeRules, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // Parser
 type Parser struct {
 	Grammar         map[string]*Rule
 	start           string
+	names           []string
+	options         map[string][]string
+	checksum        string
+	spans           map[Operator]sourceSpan
+	starts          map[Operator]int
+	traceSink       TraceSink
+	traceFlush      func() // Writes the trace events buffered until the end of a parse
 	TracerEnter     func(name string, s string, v *Values, d Any, p int)
 	TracerLeave     func(name string, s string, v *Values, d Any, p int, l int)
+	Observer        Observer        // Observer notified of the operators tried
 	RecoveryEnabled bool            // Enable error recovery
+	PackratEnabled  bool            // Enable packrat parsing, memoizing the results of rules
 	MaxErrors       int             // Maximum number of errors to report before stopping
 	TracingOptions  *TracingOptions // Options for tracing
+	Warnings        []LintWarning   // Warnings of the grammar linter
 }
 
 // findNextMeaningfulToken attempts to find the next token to continue parsing after an error
@@ -520,10 +664,10 @@ func findNextMeaningfulToken(s string, pos int, delimiters []string) int {
 	return pos
 }
 
-// EnableTracing sets up tracing with the specified options
+// EnableTracing sets up tracing with the specified options. The events are
+// written as text or JSON lines to the output of the options, or passed to
+// their sink.
 func (p *Parser) EnableTracing(options *TracingOptions) {
-	p.TracingOptions = options
-
 	if options == nil {
 		// Default options if none provided
 		options = &TracingOptions{
@@ -534,51 +678,136 @@ func (p *Parser) EnableTracing(options *TracingOptions) {
 			OutputFormat:     "text",
 		}
 	}
+	p.TracingOptions = options
+	sink := options.sink()
+	p.traceSink = sink
+
+	p.TracerEnter = nil
+	p.TracerLeave = nil
+	p.traceFlush = nil
+	if !options.ShowRuleEntry && !options.ShowRuleExit && !options.ShowTokens && !options.FarthestFailuresOnly {
+		return
+	}
 
 	// Set up tracers based on options
-	if options.ShowRuleEntry || options.ShowRuleExit {
-		indent := func(level int) string {
-			s := ""
-			for level > 0 {
-				s = s + "  "
-				level--
+	level := 0
+	prevPos := 0
+	var rules []string // Innermost rules of the operators being tried
+
+	// The filters of the events but RulesOnly, which doesn't apply to the
+	// tokens of token boundaries
+	show := func(p int) bool {
+		if p < options.StartPos || (options.EndPos != 0 && p >= options.EndPos) {
+			return false
+		}
+		if options.MaxDepth != 0 && level > options.MaxDepth {
+			return false
+		}
+		return options.matchRule(rules[len(rules)-1])
+	}
+	showOpe := func(name string) bool {
+		return !options.RulesOnly || traceRuleName(name) != ""
+	}
+
+	// Failures at the farthest position, written when the parse ends
+	var failures []*TraceEvent
+	if options.FarthestFailuresOnly {
+		p.traceFlush = func() {
+			for _, ev := range failures {
+				sink.Trace(ev)
 			}
-			return s
+			failures = nil
+			level = 0
+			prevPos = 0
+			rules = rules[:0]
 		}
+	}
 
-		level := 0
-		prevPos := 0
+	p.TracerEnter = func(name string, s string, v *Values, d Any, p int) {
+		rule := traceRuleName(name)
+		if rule == "" && len(rules) > 0 {
+			rule = rules[len(rules)-1]
+		}
+		rules = append(rules, rule)
+
+		if options.ShowRuleEntry && !options.FarthestFailuresOnly && showOpe(name) && show(p) {
+			sink.Trace(&TraceEvent{
+				Kind:      TraceEnter,
+				Name:      name,
+				Rule:      traceRuleName(name),
+				Pos:       p,
+				Depth:     level,
+				Backtrack: p < prevPos,
+			})
+		}
+		prevPos = p
+		level++
+	}
 
-		if options.ShowRuleEntry {
-			p.TracerEnter = func(name string, s string, v *Values, d Any, p int) {
-				var backtrack string
-				if p < prevPos {
-					backtrack = "*"
-				}
-				fmt.Printf("%d:%d%s\t%s%s\n", p, level, backtrack, indent(level), name)
-				prevPos = p
-				level++
-			}
+	p.TracerLeave = func(name string, s string, v *Values, d Any, p int, l int) {
+		level--
+		defer func() { rules = rules[:len(rules)-1] }()
+		if !show(p) {
+			return
 		}
 
-		if options.ShowRuleExit {
-			p.TracerLeave = func(name string, s string, v *Values, d Any, p int, l int) {
-				level--
-				if l >= 0 {
-					fmt.Printf("%d:%d\t%s%s (SUCCESS, len=%d)\n", p, level, indent(level), name, l)
-				} else {
-					fmt.Printf("%d:%d\t%s%s (FAILED)\n", p, level, indent(level), name)
+		ev := &TraceEvent{
+			Kind:  TraceLeave,
+			Name:  name,
+			Rule:  traceRuleName(name),
+			Pos:   p,
+			Depth: level,
+			Len:   l,
+		}
+		if options.FarthestFailuresOnly {
+			if l < 0 && showOpe(name) {
+				if len(failures) > 0 && p > failures[0].Pos {
+					failures = failures[:0]
+				}
+				if len(failures) == 0 || p == failures[0].Pos {
+					failures = append(failures, ev)
 				}
 			}
+			return
+		}
+
+		if options.ShowTokens && l >= 0 && name == "tokenBoundary" && len(v.Ts) > 0 {
+			t := v.Ts[len(v.Ts)-1]
+			sink.Trace(&TraceEvent{
+				Kind:  TraceToken,
+				Name:  name,
+				Pos:   t.Pos,
+				Depth: level,
+				Token: t.S,
+			})
+		}
+		if options.ShowRuleExit && showOpe(name) {
+			sink.Trace(ev)
 		}
 	}
 }
 
+// TraceErr returns the first error writing the trace, if the sink of the
+// tracing options has an Err method like the sinks of this package.
+func (p *Parser) TraceErr() error {
+	if s, ok := p.traceSink.(interface{ Err() error }); ok {
+		return s.Err()
+	}
+	return nil
+}
+
+// flushTrace writes the trace events buffered until the end of a parse.
+func (p *Parser) flushTrace() {
+	if p.traceFlush != nil {
+		p.traceFlush()
+	}
+}
+
 func NewParser(s string) (p *Parser, err error) {
 	return NewParserWithUserRules(s, nil)
 }
 
-func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err error) {
+func NewParserWithUserRules(s string, rules map[string]Operator) (p *Parser, err error) {
 	data := newData()
 
 	_, _, err = rStart.Parse(s, data)
@@ -587,7 +816,13 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 	}
 
 	// User provided rules
-	for name, ope := range rules {
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ope := rules[name]
 		ignore := false
 
 		if len(name) > 0 && name[0] == '~' {
@@ -596,6 +831,9 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 		}
 
 		if len(name) > 0 {
+			if _, ok := data.grammar[name]; !ok {
+				data.names = append(data.names, name)
+			}
 			data.grammar[name] = &Rule{
 				Ope:    ope,
 				Name:   name,
@@ -604,37 +842,61 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 		}
 	}
 
-	// Check duplicated definitions
-	if len(data.duplicates) > 0 {
-		err = &Error{}
-		for _, dup := range data.duplicates {
-			ln, col := lineInfo(s, dup.pos)
-			msg := "'" + dup.name + "' is already defined."
-			err.(*Error).Details = append(err.(*Error).Details, ErrorDetail{ln, col, msg, ""})
+	return newParser(s, data)
+}
+
+// newParser checks and links the rules collected in data. s is the grammar
+// text the rule positions refer to.
+func newParser(s string, data *data) (p *Parser, err error) {
+	names := orderedRuleNames(data.names, data.grammar)
+
+	gerr := &GrammarError{BaseError: Error{Type: GrammarErrorType}}
+	addError := func(pos int, name, errorType, msg string) {
+		if len(gerr.BaseError.Details) == 0 {
+			gerr.RuleName = name
+			gerr.ErrorType = errorType
 		}
+		ln, col := lineInfo(s, pos)
+		gerr.BaseError.Details = append(gerr.BaseError.Details, ErrorDetail{ln, col, msg, ""})
+	}
+
+	// Check duplicated definitions
+	for _, dup := range data.duplicates {
+		addError(dup.pos, dup.name, "duplicate definition", "'"+dup.name+"' is already defined.")
+		gerr.suggestions = append(gerr.suggestions, "Rename or remove one of the definitions of '"+dup.name+"'.")
 	}
 
 	// Check missing definitions
-	for _, r := range data.grammar {
+	for _, name := range names {
+		r := data.grammar[name]
 		v := &referenceChecker{
-			grammar:  data.grammar,
-			params:   r.Parameters,
-			errorPos: make(map[string]int),
-			errorMsg: make(map[string]string),
+			grammar:   data.grammar,
+			params:    r.Parameters,
+			errorPos:  make(map[string]int),
+			errorMsg:  make(map[string]string),
+			errorType: make(map[string]string),
 		}
 		r.accept(v)
-		for name, pos := range v.errorPos {
-			if err == nil {
-				err = &Error{}
+
+		var refs []string
+		for ref := range v.errorPos {
+			refs = append(refs, ref)
+		}
+		sort.Slice(refs, func(i, j int) bool { return v.errorPos[refs[i]] < v.errorPos[refs[j]] })
+
+		for _, ref := range refs {
+			addError(v.errorPos[ref], ref, v.errorType[ref], v.errorMsg[ref])
+			if v.errorType[ref] == "undefined rule" {
+				candidates := append(append([]string{}, names...), r.Parameters...)
+				if similar := similarNames(ref, candidates); len(similar) > 0 {
+					gerr.suggestions = append(gerr.suggestions, "'"+ref+"' is not defined. Did you mean "+quoteNames(similar)+"?")
+				}
 			}
-			ln, col := lineInfo(s, pos)
-			msg := v.errorMsg[name]
-			err.(*Error).Details = append(err.(*Error).Details, ErrorDetail{ln, col, msg, ""})
 		}
 	}
 
-	if err != nil {
-		return nil, err
+	if len(gerr.BaseError.Details) > 0 {
+		return nil, gerr
 	}
 
 	// Link references
@@ -647,7 +909,8 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 	}
 
 	// Check left recursion
-	for name, r := range data.grammar {
+	for _, name := range names {
+		r := data.grammar[name]
 		v := &detectLeftRecursion{
 			pos:    -1,
 			name:   name,
@@ -657,19 +920,30 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 		}
 		r.accept(v)
 		if v.pos != -1 {
-			if err == nil {
-				err = &Error{}
-			}
-			ln, col := lineInfo(s, v.pos)
-			msg := "'" + name + "' is left recursive."
-			err.(*Error).Details = append(err.(*Error).Details, ErrorDetail{ln, col, msg, ""})
+			addError(v.pos, name, "left recursion", "'"+name+"' is left recursive.")
+			gerr.suggestions = append(gerr.suggestions, "Rewrite '"+name+"' with a repetition, like 'A <- B (Op B)*' instead of 'A <- A Op B / B'.")
 		}
 	}
 
-	if err != nil {
-		return nil, err
+	if len(gerr.BaseError.Details) > 0 {
+		return nil, gerr
 	}
 
+	p = assembleParser(data)
+	if s != "" {
+		p.checksum = GrammarChecksum(s)
+	}
+	p.Warnings = Lint(p)
+
+	// Setup expression parsing
+	name, info := getExpressionParsingOptions(data.options)
+	err = EnableExpressionParsing(p, name, info)
+
+	return
+}
+
+// assembleParser returns the parser of linked rules.
+func assembleParser(data *data) *Parser {
 	// Automatic whitespace skipping
 	if r, ok := data.grammar[WhitespceRuleName]; ok {
 		data.grammar[data.start].WhitespaceOpe = Wsp(r)
@@ -680,16 +954,14 @@ func NewParserWithUserRules(s string, rules map[string]operator) (p *Parser, err
 		data.grammar[data.start].WordOpe = r
 	}
 
-	p = &Parser{
+	return &Parser{
 		Grammar: data.grammar,
 		start:   data.start,
+		names:   data.names,
+		options: data.options,
+		spans:   data.spans,
+		starts:  data.starts,
 	}
-
-	// Setup expression parsing
-	name, info := getExpressionParsingOptions(data.options)
-	err = EnableExpressionParsing(p, name, info)
-
-	return
 }
 
 func (p *Parser) Parse(s string, d Any) (err error) {
@@ -719,6 +991,8 @@ func (p *Parser) ParseWithRecovery(s string, d Any) (errs []error) {
 		r := p.Grammar[p.start]
 		r.TracerEnter = p.TracerEnter
 		r.TracerLeave = p.TracerLeave
+		r.Observer = p.Observer
+		r.packrat = p.PackratEnabled
 
 		l, _, err := r.Parse(s[pos:], d)
 
@@ -747,6 +1021,8 @@ func (p *Parser) ParseWithRecovery(s string, d Any) (errs []error) {
 		}
 	}
 
+	p.flushTrace()
+
 	return
 }
 
@@ -754,20 +1030,25 @@ func (p *Parser) ParseAndGetValue(s string, d Any) (val Any, err error) {
 	r := p.Grammar[p.start]
 	r.TracerEnter = p.TracerEnter
 	r.TracerLeave = p.TracerLeave
+	r.Observer = p.Observer
+	r.packrat = p.PackratEnabled
 	_, val, err = r.Parse(s, d)
+	p.flushTrace()
 
 	// Show error context if enabled
 	if err != nil && p.TracingOptions != nil && p.TracingOptions.ShowErrorContext {
-		fmt.Println("\nError Context:")
-		fmt.Println(err.Error())
+		ev := &TraceEvent{Kind: TraceError, Message: err.Error()}
 
 		// If it's a syntax error with expected tokens, show suggestions
 		if syntaxErr, ok := err.(*SyntaxError); ok {
-			fmt.Println("\nSuggestions:")
-			for _, suggestion := range syntaxErr.GetSuggestions() {
-				fmt.Println("- " + suggestion)
-			}
+			ev.Suggestions = syntaxErr.GetSuggestions()
 		}
+
+		sink := p.traceSink
+		if sink == nil {
+			sink = p.TracingOptions.sink()
+		}
+		sink.Trace(ev)
 	}
 
 	return
@@ -796,6 +1077,8 @@ func (p *Parser) ParseAndGetValueWithRecovery(s string, d Any) (val Any, errs []
 		r := p.Grammar[p.start]
 		r.TracerEnter = p.TracerEnter
 		r.TracerLeave = p.TracerLeave
+		r.Observer = p.Observer
+		r.packrat = p.PackratEnabled
 
 		l, v, err := r.Parse(s[pos:], d)
 
@@ -825,5 +1108,7 @@ func (p *Parser) ParseAndGetValueWithRecovery(s string, d Any) (val Any, errs []
 		}
 	}
 
+	p.flushTrace()
+
 	return
 }
@@ -784,10 +784,54 @@ func TestLeftRecursiveWithEmptyString(t *testing.T) {
 	assert(t, err != nil)
 }
 
+func TestGrammarErrorUndefinedRule(t *testing.T) {
+	_, err := NewParser(`
+        Start      <- Expresion
+        Expression <- Term ('+' Term)*
+        Term       <- number
+        NUMBER     <- [0-9]+
+    `)
+
+	gerr, ok := err.(*GrammarError)
+	assert(t, ok)
+	assert(t, gerr.BaseError.Type == GrammarErrorType)
+	assert(t, gerr.RuleName == "Expresion")
+	assert(t, gerr.ErrorType == "undefined rule")
+	assert(t, len(gerr.BaseError.Details) == 2)
+	assert(t, gerr.BaseError.Details[0].Ln == 2 && gerr.BaseError.Details[0].Col == 23)
+
+	suggestions := gerr.GetSuggestions()
+	assert(t, len(suggestions) == 2)
+	assert(t, suggestions[0] == "'Expresion' is not defined. Did you mean 'Expression'?")
+	assert(t, suggestions[1] == "'number' is not defined. Did you mean 'NUMBER'?")
+}
+
+func TestGrammarErrorUserRules(t *testing.T) {
+	_, err := NewParserWithUserRules("ROOT <- NAME", map[string]Operator{
+		"NAMES": Lit("a"),
+	})
+
+	gerr, ok := err.(*GrammarError)
+	assert(t, ok)
+	assert(t, gerr.BaseError.Type == GrammarErrorType)
+	assert(t, gerr.ErrorType == "undefined rule")
+	assert(t, gerr.GetSuggestions()[0] == "'NAME' is not defined. Did you mean 'NAMES'?")
+}
+
+func TestGrammarErrorLeftRecursive(t *testing.T) {
+	_, err := NewParser(`A <- A 'a' / 'b'`)
+
+	gerr, ok := err.(*GrammarError)
+	assert(t, ok)
+	assert(t, gerr.RuleName == "A")
+	assert(t, gerr.ErrorType == "left recursion")
+	assert(t, len(gerr.GetSuggestions()) == 1)
+}
+
 func TestUserRule(t *testing.T) {
 	syntax := " ROOT <- _ 'Hello' _ NAME '!' _ "
 
-	rules := map[string]operator{
+	rules := map[string]Operator{
 		"NAME": Usr(func(s string, p int, sv *Values, d Any) int {
 			names := []string{"PEG", "BNF"}
 			for _, name := range names {
@@ -805,6 +849,76 @@ func TestUserRule(t *testing.T) {
 	assert(t, parser.Parse(" Hello BNF! ", nil) == nil)
 }
 
+func TestGrammarBuilder(t *testing.T) {
+	b := NewGrammarBuilder()
+	b.Rule("EXPR", Seq(Ref("ATOM", nil, 0), Zom(Seq(Ref("BINOP", nil, 0), Ref("ATOM", nil, 0)))))
+	b.Rule("ATOM", Cho(Ref("NUMBER", nil, 0), Seq(Lit("("), Ref("EXPR", nil, 0), Lit(")"))))
+	b.Rule("BINOP", Tok(Cls("-+/*"))).Action = func(v *Values, d Any) (Any, error) {
+		return v.Token(), nil
+	}
+	b.Rule("NUMBER", Tok(Oom(Cls("0-9")))).Action = func(v *Values, d Any) (Any, error) {
+		return strconv.Atoi(v.Token())
+	}
+	b.Rule("%whitespace", Zom(Cls(" \t")))
+	b.Option(OptExpressionRule, "EXPR")
+	b.Option(OptBinaryOperator, "L + -")
+	b.Option(OptBinaryOperator, "L * /")
+
+	parser, err := b.Build()
+	assert(t, err == nil)
+
+	parser.Grammar["EXPR"].Action = func(v *Values, d Any) (Any, error) {
+		val := v.ToInt(0)
+		if v.Len() > 1 {
+			rhs := v.ToInt(2)
+			switch v.ToStr(1) {
+			case "+":
+				val += rhs
+			case "-":
+				val -= rhs
+			case "*":
+				val *= rhs
+			case "/":
+				val /= rhs
+			}
+		}
+		return val, nil
+	}
+
+	val, err := parser.ParseAndGetValue(" 1 + 2 * 3 * (4 - 5 + 6) / 7 - 8 ", nil)
+	assert(t, err == nil)
+	assert(t, val == -3)
+}
+
+func TestGrammarBuilderErrors(t *testing.T) {
+	b := NewGrammarBuilder()
+	b.Rule("A", Seq(Ref("A", nil, 0), Lit("a")))
+	_, err := b.Build()
+	assert(t, err != nil)
+
+	b = NewGrammarBuilder()
+	b.Rule("A", Ref("B", nil, 0))
+	b.Rule("A", Lit("a"))
+	_, err = b.Build()
+	assert(t, err != nil)
+	assert(t, len(err.(*GrammarError).BaseError.Details) == 2)
+
+	b = NewGrammarBuilder()
+	b.Start("A")
+	_, err = b.Build()
+	var gerr *GrammarError
+	assert(t, errors.As(err, &gerr))
+	assert(t, gerr.RuleName == "A" && gerr.BaseError.Details[0].Msg == "start rule 'A' is not defined.")
+	assert(t, gerr.BaseError.Details[0].Ln == 1 && gerr.BaseError.Details[0].Col == 1 && len(gerr.GetSuggestions()) == 0)
+
+	b = NewGrammarBuilder()
+	b.Rule("LIST", Lit("a"))
+	b.Start("LST")
+	_, err = b.Link()
+	assert(t, errors.As(err, &gerr))
+	assert(t, gerr.RuleName == "LST" && gerr.GetSuggestions()[0] == "'LST' is not defined. Did you mean 'LIST'?")
+}
+
 func TestSemanticPredicate(t *testing.T) {
 	parser, _ := NewParser("NUMBER  <-  [0-9]+")
 
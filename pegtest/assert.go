@@ -0,0 +1,204 @@
+package pegtest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	peg "github.com/yhirose/go-peg"
+	"github.com/yhirose/go-peg/internal/diff"
+)
+
+// MustNewParser returns the parser of a grammar, and stops the test if the
+// grammar has errors.
+func MustNewParser(t testing.TB, grammar string) *peg.Parser {
+	t.Helper()
+	p, err := peg.NewParser(grammar)
+	if err != nil {
+		t.Fatalf("grammar error:\n%v", err)
+	}
+	return p
+}
+
+// MustParse parses input with p and returns the semantic value, and stops
+// the test if the parse fails.
+func MustParse(t testing.TB, p *peg.Parser, input string) peg.Any {
+	t.Helper()
+	val, err := p.ParseAndGetValue(input, nil)
+	if err != nil {
+		t.Fatalf("parse of %q failed:\n%v", input, err)
+	}
+	return val
+}
+
+// AssertMatches checks that the rule matches the whole input, and returns
+// whether it does. The %whitespace and %word definitions of the grammar
+// apply to the rule like to the start rule.
+func AssertMatches(t testing.TB, p *peg.Parser, rule, input string) bool {
+	t.Helper()
+	_, err := parseRule(p, rule, input)
+	if err != nil {
+		t.Errorf("'%s' doesn't match %q:\n%v", rule, input, err)
+		return false
+	}
+	return true
+}
+
+// AssertFailsAt checks that the parse of input fails at the line and the
+// column, both starting at 1, and returns whether it does.
+func AssertFailsAt(t testing.TB, p *peg.Parser, input string, line, col int) bool {
+	t.Helper()
+	return assertFailsAt(t, p, "", input, line, col)
+}
+
+func assertFailsAt(t testing.TB, p *peg.Parser, rule, input string, line, col int) bool {
+	t.Helper()
+	_, err := parseRule(p, rule, input)
+	if err == nil {
+		t.Errorf("parse of %q succeeded, expected an error at %d:%d", input, line, col)
+		return false
+	}
+	details := errorDetails(err)
+	if len(details) == 0 {
+		t.Errorf("parse of %q failed without a position, expected an error at %d:%d:\n%v", input, line, col, err)
+		return false
+	}
+	if d := details[0]; d.Ln != line || d.Col != col {
+		t.Errorf("parse of %q failed at %d:%d, expected an error at %d:%d:\n%v", input, d.Ln, d.Col, line, col, err)
+		return false
+	}
+	return true
+}
+
+// AssertAST checks that the AST of input is the expected tree, in the format
+// of Ast.String, and returns whether it is. A difference is reported as a
+// diff. The indentation common to the lines of expected and blank lines
+// around them are ignored, so the tree can be written in a raw string
+// literal indented like the code. The parser must build ASTs: see EnableAst.
+func AssertAST(t testing.TB, p *peg.Parser, input, expected string) bool {
+	t.Helper()
+	return assertAST(t, p, "", input, expected)
+}
+
+func assertAST(t testing.TB, p *peg.Parser, rule, input, expected string) bool {
+	t.Helper()
+	val, err := parseRule(p, rule, input)
+	if err != nil {
+		t.Errorf("parse of %q failed:\n%v", input, err)
+		return false
+	}
+	ast, ok := val.(*peg.Ast)
+	if !ok {
+		t.Errorf("parse of %q returned %T, not an AST: see EnableAst", input, val)
+		return false
+	}
+	if d := diff.Unified("expected", "actual", dedent(expected), ast.String()); d != "" {
+		t.Errorf("AST of %q differs:\n%s", input, d)
+		return false
+	}
+	return true
+}
+
+// parseRule parses the whole input with the rule, or the start rule if rule
+// is empty.
+func parseRule(p *peg.Parser, rule, input string) (peg.Any, error) {
+	if rule == "" || rule == p.Start() {
+		return p.ParseAndGetValue(input, nil)
+	}
+
+	r, ok := p.Grammar[rule]
+	if !ok {
+		return nil, errors.New("'" + rule + "' is not defined.")
+	}
+
+	// The rule is parsed like the start rule by ParseAndGetValue, with the
+	// %whitespace and %word definitions of the grammar
+	start := p.Grammar[p.Start()]
+	item := *r
+	item.WhitespaceOpe = start.WhitespaceOpe
+	item.WordOpe = start.WordOpe
+	item.TracerEnter = p.TracerEnter
+	item.TracerLeave = p.TracerLeave
+	item.Observer = p.Observer
+	l, val, err := item.Parse(input, nil)
+	if err != nil && l != -1 {
+		return nil, errors.New("'" + rule + "' matches only the beginning of the input.")
+	}
+	return val, err
+}
+
+// dedent removes the indentation common to the lines of s and the blank
+// lines around them, and ends s with a newline.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent {
+			lines[i] = line[indent:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Case is a case of a table driven test run by Run.
+type Case struct {
+	Name  string // Name of the subtest, the input if empty
+	Rule  string // Rule parsing the input, the start rule if empty
+	Input string
+
+	// Expected results. The parse must succeed unless Line is set.
+	Line, Col int     // Position of the error
+	AST       string  // AST, in the format of AssertAST
+	Value     peg.Any // Semantic value, compared with reflect.DeepEqual
+}
+
+// Run runs each case as a subtest, checking that the parse of its input
+// succeeds with the expected AST or value, or fails at the expected position.
+func Run(t *testing.T, p *peg.Parser, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		name := c.Name
+		if name == "" {
+			name = c.Input
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			switch {
+			case c.Line != 0:
+				assertFailsAt(t, p, c.Rule, c.Input, c.Line, c.Col)
+			case c.AST != "":
+				assertAST(t, p, c.Rule, c.Input, c.AST)
+			default:
+				val, err := parseRule(p, c.Rule, c.Input)
+				if err != nil {
+					t.Errorf("parse of %q failed:\n%v", c.Input, err)
+				} else if c.Value != nil && !reflect.DeepEqual(val, c.Value) {
+					t.Errorf("value of %q is %#v, expected %#v", c.Input, val, c.Value)
+				}
+			}
+		})
+	}
+}
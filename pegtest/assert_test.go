@@ -0,0 +1,163 @@
+package pegtest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+// fakeTB records the failures of a check.
+type fakeTB struct {
+	testing.TB
+	failure string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.failure += fmt.Sprintf(format, args...)
+}
+
+func (tb *fakeTB) Fatalf(format string, args ...interface{}) {
+	tb.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// failure returns the failures of check, or "" if it passes.
+func failure(t *testing.T, check func(tb testing.TB)) string {
+	tb := &fakeTB{TB: t}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		check(tb)
+	}()
+	<-done
+	return tb.failure
+}
+
+func assert(t *testing.T, ok bool) {
+	t.Helper()
+	if !ok {
+		t.Error("assert failed")
+	}
+}
+
+const listGrammar = `
+    LIST        <- ITEM (',' ITEM)*
+    ITEM        <- NUMBER / NAME / '[' LIST? ']'
+    NUMBER      <- < [0-9]+ >
+    NAME        <- < [a-z]+ >
+    %whitespace <- [ \t\n]*
+`
+
+func TestMustNewParser(t *testing.T) {
+	assert(t, MustNewParser(t, listGrammar) != nil)
+
+	msg := failure(t, func(tb testing.TB) { MustNewParser(tb, "A <- B") })
+	assert(t, strings.HasPrefix(msg, "grammar error:\n"))
+}
+
+func TestMustParse(t *testing.T) {
+	p := MustNewParser(t, listGrammar)
+	p.Grammar["NUMBER"].Action = func(v *peg.Values, d peg.Any) (peg.Any, error) {
+		return v.Token(), nil
+	}
+	assert(t, MustParse(t, p, "12, a") == "12")
+
+	msg := failure(t, func(tb testing.TB) { MustParse(tb, p, "1,") })
+	assert(t, strings.HasPrefix(msg, `parse of "1," failed:`))
+}
+
+func TestAssertMatches(t *testing.T) {
+	p := MustNewParser(t, listGrammar)
+	assert(t, AssertMatches(t, p, "LIST", "1, [a, 2]"))
+	assert(t, AssertMatches(t, p, "ITEM", " [ 1 , b ] "))
+	assert(t, AssertMatches(t, p, "NUMBER", "42"))
+
+	msg := failure(t, func(tb testing.TB) { AssertMatches(tb, p, "ITEM", "1, 2") })
+	assert(t, msg == "'ITEM' doesn't match \"1, 2\":\n'ITEM' matches only the beginning of the input.")
+	msg = failure(t, func(tb testing.TB) { AssertMatches(tb, p, "NUMBER", "1 2") })
+	assert(t, msg == "'NUMBER' doesn't match \"1 2\":\n'NUMBER' matches only the beginning of the input.")
+	msg = failure(t, func(tb testing.TB) { AssertMatches(tb, p, "NAME", "a1") })
+	assert(t, strings.HasPrefix(msg, `'NAME' doesn't match "a1":`))
+	assert(t, failure(t, func(tb testing.TB) { AssertMatches(tb, p, "NAME", " ") }) != "")
+	assert(t, failure(t, func(tb testing.TB) { AssertMatches(tb, p, "UNDEFINED", "a") }) != "")
+}
+
+func TestAssertFailsAt(t *testing.T) {
+	p := MustNewParser(t, listGrammar)
+	assert(t, AssertFailsAt(t, p, "[1,\n2", 2, 2))
+
+	msg := failure(t, func(tb testing.TB) { AssertFailsAt(tb, p, "[1,\n2", 1, 3) })
+	assert(t, strings.HasPrefix(msg, `parse of "[1,\n2" failed at 2:2, expected an error at 1:3:`))
+	msg = failure(t, func(tb testing.TB) { AssertFailsAt(tb, p, "1", 1, 1) })
+	assert(t, msg == `parse of "1" succeeded, expected an error at 1:1`)
+}
+
+func TestAssertAST(t *testing.T) {
+	p := MustNewParser(t, listGrammar)
+	p.EnableAst()
+
+	assert(t, AssertAST(t, p, "1, [a]", `
+        + LIST
+          + ITEM
+            - NUMBER ("1")
+          + ITEM
+            + LIST
+              + ITEM
+                - NAME ("a")
+    `))
+
+	msg := failure(t, func(tb testing.TB) {
+		AssertAST(tb, p, "1, b", `
+            + LIST
+              + ITEM
+                - NUMBER ("1")
+              + ITEM
+                - NUMBER ("2")
+        `)
+	})
+	expected := `AST of "1, b" differs:
+--- expected
++++ actual
+@@ -2,4 +2,4 @@
+   + ITEM
+     - NUMBER ("1")
+   + ITEM
+-    - NUMBER ("2")
++    - NAME ("b")
+`
+	if msg != expected {
+		t.Errorf("unexpected failure:\n%s", msg)
+	}
+
+	p = MustNewParser(t, listGrammar)
+	msg = failure(t, func(tb testing.TB) { AssertAST(tb, p, "1", "+ LIST") })
+	assert(t, msg == `parse of "1" returned <nil>, not an AST: see EnableAst`)
+}
+
+func TestRun(t *testing.T) {
+	p := MustNewParser(t, listGrammar)
+	p.Grammar["NAME"].Action = func(v *peg.Values, d peg.Any) (peg.Any, error) {
+		return strings.ToUpper(v.Token()), nil
+	}
+
+	Run(t, p, []Case{
+		{Input: "1, [a, 2]"},
+		{Name: "name", Rule: "NAME", Input: "abc", Value: "ABC"},
+		{Name: "unclosed", Input: "[1", Line: 1, Col: 3},
+		{Rule: "ITEM", Input: "[1,]", Line: 1, Col: 4},
+	})
+
+	p.EnableAst()
+	Run(t, p, []Case{
+		{Input: "a", AST: `
+            + LIST
+              + ITEM
+                - NAME ("a")
+        `},
+	})
+}
@@ -0,0 +1,3 @@
+// Package pegtest provides helpers for testing grammars built with the peg
+// package and the actions attached to them.
+package pegtest
@@ -0,0 +1,21 @@
+package pegtest
+
+import peg "github.com/yhirose/go-peg"
+
+// errorDetails returns the positioned details of an error of a parse.
+func errorDetails(err error) []peg.ErrorDetail {
+	switch e := err.(type) {
+	case *peg.Error:
+		return e.Details
+	case *peg.SyntaxError:
+		return e.BaseError.Details
+	}
+	return nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,211 @@
+//go:build go1.18
+// +build go1.18
+
+package pegtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+// Number of samples generated from the grammar to seed the corpus
+const fuzzSeeds = 32
+
+// Time after which a parse with error recovery is considered to loop
+var recoveryTimeout = 10 * time.Second
+
+// FuzzParser runs CheckParse on the inputs of a fuzz test, with a corpus
+// seeded with an empty input and with samples generated from the grammar.
+//
+//	func FuzzGrammar(f *testing.F) {
+//		pegtest.FuzzParser(f, newParser())
+//	}
+//
+// Run it with 'go test -fuzz FuzzGrammar'. The parses are sequential, so p
+// may be shared with other tests, but not with parses running concurrently.
+func FuzzParser(f *testing.F, p *peg.Parser) {
+	f.Helper()
+
+	f.Add("")
+	g := peg.NewSampleGenerator(p, 1)
+	for i := 0; i < fuzzSeeds; i++ {
+		if s, err := g.Sample(); err == nil {
+			f.Add(s)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		CheckParse(t, p, input)
+	})
+}
+
+// CheckParse parses input with p and checks the invariants of a parse:
+//
+//   - the parse and the actions don't panic
+//   - the errors are positioned in the input
+//   - packrat parsing gives the same value or error position as parsing
+//     without it
+//   - a parse with error recovery terminates, with at most MaxErrors errors
+//
+// Actions are invoked by each parse, with nil data. Values are compared with
+// reflect.DeepEqual, and ASTs by their text.
+func CheckParse(t testing.TB, p *peg.Parser, input string) {
+	t.Helper()
+
+	packrat := p.PackratEnabled
+	defer func() { p.PackratEnabled = packrat }()
+
+	var val, packratVal peg.Any
+	var err, packratErr error
+	p.PackratEnabled = false
+	checkPanic(t, "parse", input, func() {
+		val, err = p.ParseAndGetValue(input, nil)
+	})
+	checkErrorPos(t, input, err)
+
+	p.PackratEnabled = true
+	checkPanic(t, "packrat parse", input, func() {
+		packratVal, packratErr = p.ParseAndGetValue(input, nil)
+	})
+	checkErrorPos(t, input, packratErr)
+	p.PackratEnabled = packrat
+
+	if !sameResult(val, err, packratVal, packratErr) {
+		t.Fatalf("parse and packrat parse of %q disagree:\n%s\n---\n%s", input, resultString(val, err), resultString(packratVal, packratErr))
+	}
+
+	checkRecovery(t, p, input)
+}
+
+// sameResult reports whether two parses give the same value, or fail at the
+// same position.
+func sameResult(val1 peg.Any, err1 error, val2 peg.Any, err2 error) bool {
+	if err1 != nil || err2 != nil {
+		return errorPosition(err1) == errorPosition(err2)
+	}
+	ast1, ok1 := val1.(*peg.Ast)
+	ast2, ok2 := val2.(*peg.Ast)
+	if ok1 && ok2 {
+		return ast1.String() == ast2.String()
+	}
+	return reflect.DeepEqual(val1, val2)
+}
+
+func resultString(val peg.Any, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if ast, ok := val.(*peg.Ast); ok {
+		return ast.String()
+	}
+	return fmt.Sprintf("%#v", val)
+}
+
+// errorPosition returns the position of an error of a parse as line:col, or
+// the error if it has none.
+func errorPosition(err error) string {
+	if details := errorDetails(err); len(details) > 0 {
+		return fmt.Sprintf("%d:%d", details[0].Ln, details[0].Col)
+	}
+	return errorString(err)
+}
+
+// errStopped is the panic stopping a parse with recovery that doesn't
+// terminate.
+var errStopped = errors.New("parse stopped")
+
+// stopObserver panics with errStopped when its channel is closed.
+type stopObserver chan struct{}
+
+func (so stopObserver) Enter(ev *peg.ParseEvent) {
+	select {
+	case <-so:
+		panic(errStopped)
+	default:
+	}
+}
+
+func (so stopObserver) Leave(ev *peg.ParseEvent) {}
+
+// checkRecovery checks that a parse with error recovery terminates. It parses
+// with a copy of p with recovery enabled, so p isn't changed, and stops the
+// parse on timeout before returning, as the copy shares the rules of p.
+func checkRecovery(t testing.TB, p *peg.Parser, input string) {
+	t.Helper()
+
+	stop := make(stopObserver)
+	q := *p
+	q.RecoveryEnabled = true
+	q.Observer = peg.MultiObserver(p.Observer, stop)
+	maxErrors := p.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = 10
+	}
+
+	done := make(chan []error, 1)
+	panics := make(chan string, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panics <- fmt.Sprintf("%v\n%s", r, debug.Stack())
+			}
+		}()
+		_, errs := q.ParseAndGetValueWithRecovery(input, nil)
+		done <- errs
+	}()
+
+	select {
+	case errs := <-done:
+		if len(errs) > maxErrors {
+			t.Fatalf("parse with recovery of %q returned %d errors, more than %d", input, len(errs), maxErrors)
+		}
+	case msg := <-panics:
+		t.Fatalf("panic in parse with recovery of %q: %s", input, msg)
+	case <-time.After(recoveryTimeout):
+		close(stop)
+		select {
+		case <-done:
+		case <-panics:
+		case <-time.After(recoveryTimeout):
+			// Stuck in a user defined operator, which isn't observed
+			t.Fatalf("parse with recovery of %q doesn't terminate and can't be stopped: p must not be used anymore", input)
+		}
+		t.Fatalf("parse with recovery of %q doesn't terminate", input)
+	}
+}
+
+func checkPanic(t testing.TB, what string, input string, parse func()) {
+	t.Helper()
+
+	var msg string
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = fmt.Sprintf("%v\n%s", r, debug.Stack())
+			}
+		}()
+		parse()
+	}()
+	if msg != "" {
+		t.Fatalf("panic in %s of %q: %s", what, input, msg)
+	}
+}
+
+// checkErrorPos checks that the lines and the columns of err are in input.
+func checkErrorPos(t testing.TB, input string, err error) {
+	t.Helper()
+
+	lines := strings.Split(input, "\n")
+	for _, d := range errorDetails(err) {
+		if d.Ln < 1 || d.Ln > len(lines) || d.Col < 1 || d.Col > len(lines[d.Ln-1])+1 {
+			t.Fatalf("error of %q at %d:%d, out of the input: %v", input, d.Ln, d.Col, err)
+		}
+	}
+}
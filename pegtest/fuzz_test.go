@@ -0,0 +1,115 @@
+//go:build go1.18
+// +build go1.18
+
+package pegtest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	peg "github.com/yhirose/go-peg"
+)
+
+func newCalcParser(t testing.TB) *peg.Parser {
+	p, err := peg.NewParser(`
+        EXPR        <- TERM (< [-+] > TERM)*
+        TERM        <- NUMBER / '(' EXPR ')'
+        NUMBER      <- < [0-9]+ >
+        %whitespace <- [ \t\n]*
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Grammar["NUMBER"].Action = func(v *peg.Values, d peg.Any) (peg.Any, error) {
+		n, err := strconv.Atoi(v.Token())
+		if err != nil {
+			return nil, errors.New("number out of range")
+		}
+		return n, nil
+	}
+	return p
+}
+
+func FuzzCalc(f *testing.F) {
+	FuzzParser(f, newCalcParser(f))
+}
+
+func TestCheckParse(t *testing.T) {
+	p := newCalcParser(t)
+	for _, input := range []string{"", "1 + (2 - 3)", "1 +", "(1", "99999999999999999999", "1\n+\n)"} {
+		if msg := failure(t, func(tb testing.TB) { CheckParse(tb, p, input) }); msg != "" {
+			t.Errorf("%q: %s", input, msg)
+		}
+	}
+	assert(t, !p.RecoveryEnabled && !p.PackratEnabled)
+}
+
+func TestCheckParsePackrat(t *testing.T) {
+	p := newCalcParser(t)
+	assert(t, failure(t, func(tb testing.TB) { CheckParse(tb, p, "(1 + 2") }) == "")
+
+	// An action with a side effect gives another value with packrat parsing
+	n := 0
+	p.Grammar["TERM"].Action = func(v *peg.Values, d peg.Any) (peg.Any, error) {
+		n++
+		return n, nil
+	}
+	msg := failure(t, func(tb testing.TB) { CheckParse(tb, p, "1") })
+	assert(t, msg == "parse and packrat parse of \"1\" disagree:\n1\n---\n2")
+	assert(t, !p.PackratEnabled)
+}
+
+func TestCheckRecoveryTimeout(t *testing.T) {
+	timeout := recoveryTimeout
+	recoveryTimeout = 20 * time.Millisecond
+	defer func() { recoveryTimeout = timeout }()
+
+	p, err := peg.NewParser(`
+        ROOT <- ITEM+
+        ITEM <- 'a'
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Grammar["ITEM"].Ope = peg.Usr(func(s string, p int, v *peg.Values, d peg.Any) int {
+		time.Sleep(time.Millisecond)
+		return 1
+	})
+
+	input := strings.Repeat("a", 1000)
+	msg := failure(t, func(tb testing.TB) { checkRecovery(tb, p, input) })
+	assert(t, msg == "parse with recovery of "+strconv.Quote(input)+" doesn't terminate")
+	assert(t, !p.RecoveryEnabled && p.Observer == nil)
+
+	// The parse is stopped, so the parser can be used again
+	assert(t, p.Parse("a", nil) == nil)
+}
+
+func TestCheckParsePanic(t *testing.T) {
+	p := newCalcParser(t)
+	p.Grammar["TERM"].Action = func(v *peg.Values, d peg.Any) (peg.Any, error) {
+		if v.Choice == 1 {
+			panic("parentheses")
+		}
+		return v.Vs[0], nil
+	}
+
+	assert(t, failure(t, func(tb testing.TB) { CheckParse(tb, p, "1 + 2") }) == "")
+	msg := failure(t, func(tb testing.TB) { CheckParse(tb, p, "(1)") })
+	assert(t, strings.HasPrefix(msg, `panic in parse of "(1)": parentheses`))
+}
+
+func TestCheckErrorPos(t *testing.T) {
+	err := &peg.Error{Details: []peg.ErrorDetail{{Ln: 2, Col: 3}}}
+	assert(t, failure(t, func(tb testing.TB) { checkErrorPos(tb, "a\nbc", err) }) == "")
+
+	err.Details[0].Col = 4
+	msg := failure(t, func(tb testing.TB) { checkErrorPos(tb, "a\nbc", err) })
+	assert(t, strings.HasPrefix(msg, `error of "a\nbc" at 2:4, out of the input`))
+
+	err.Details[0].Ln = 3
+	assert(t, failure(t, func(tb testing.TB) { checkErrorPos(tb, "a\nbc", err) }) != "")
+}
@@ -0,0 +1,346 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Precedence levels of the PEG syntax
+const (
+	precChoice = iota
+	precSequence
+	precPrefix
+	precSuffix
+	precPrimary
+)
+
+// printer serializes operators into PEG text.
+type printer struct {
+	buf bytes.Buffer
+	err error
+
+	// Comments of the source text written in front of the operators starting
+	// after them, for the formatter. A comment ends its line.
+	src      string
+	comments []sourceSpan
+	starts   map[Operator]int
+}
+
+// PrintOperator returns the PEG text of an operator. User defined operators
+// can't be expressed in PEG and are written as '%user', and ignored operators
+// other than references as '~(...)'.
+func PrintOperator(ope Operator) string {
+	pr := &printer{}
+	pr.print(ope, precChoice)
+	return pr.buf.String()
+}
+
+// PrintGrammar writes the grammar of a parser as PEG text: the rules in the
+// order of RuleNames, the start rule first, with aligned arrows and their doc
+// comments above them, followed by the options section. The doc comment of the
+// start rule follows an empty header, as the comments at the top of the text
+// are the header of the grammar.
+// The text can be passed to NewParser to create an equivalent parser. It
+// fails for the operators PEG text can't express: user defined operators, and
+// ignored operators other than references.
+func PrintGrammar(w io.Writer, p *Parser) error {
+	names := startFirst(p.RuleNames(), p.start)
+
+	lhs := make([]string, len(names))
+	width := 0
+	for i, name := range names {
+		lhs[i] = ruleHead(p.Grammar[name])
+		if n := len([]rune(lhs[i])); n > width {
+			width = n
+		}
+	}
+
+	pr := &printer{}
+	for i, name := range names {
+		if doc := p.Grammar[name].Doc; doc != "" {
+			if i == 0 {
+				pr.buf.WriteString("#\n\n")
+			}
+			for _, line := range strings.Split(doc, "\n") {
+				pr.buf.WriteString(strings.TrimRight("# "+line, " "))
+				pr.buf.WriteString("\n")
+			}
+		}
+		pr.buf.WriteString(padRight(lhs[i], width))
+		pr.buf.WriteString(" <- ")
+		pr.print(p.Grammar[name].Ope, precChoice)
+		if pr.err != nil {
+			return errors.New("'" + name + "' " + pr.err.Error())
+		}
+		pr.buf.WriteString("\n")
+	}
+
+	printOptions(&pr.buf, p.options)
+
+	_, err := w.Write(pr.buf.Bytes())
+	return err
+}
+
+// startFirst moves the start rule to the front, as the first definition in
+// PEG text is the start rule.
+func startFirst(names []string, start string) []string {
+	for i, name := range names {
+		if name == start {
+			copy(names[1:i+1], names[:i])
+			names[0] = start
+			break
+		}
+	}
+	return names
+}
+
+// ruleHead returns the left hand side of a rule definition.
+func ruleHead(r *Rule) string {
+	s := r.Name
+	if r.Ignore {
+		s = "~" + s
+	}
+	if r.Parameters != nil {
+		s += "(" + strings.Join(r.Parameters, ", ") + ")"
+	}
+	return s
+}
+
+func padRight(s string, width int) string {
+	if n := len([]rune(s)); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+func printOptions(buf *bytes.Buffer, options map[string][]string) {
+	names := optionNames(options)
+	if len(names) == 0 {
+		return
+	}
+
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	buf.WriteString("---\n")
+	for _, name := range names {
+		for _, val := range options[name] {
+			buf.WriteString(padRight(name, width))
+			buf.WriteString(" = ")
+			buf.WriteString(val)
+			buf.WriteString("\n")
+		}
+	}
+}
+
+// optionNames returns the names of the options with values, %expr and %binop
+// first.
+func optionNames(options map[string][]string) []string {
+	var names []string
+	for name, vs := range options {
+		if len(vs) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	order := func(name string) int {
+		switch name {
+		case OptExpressionRule:
+			return 0
+		case OptBinaryOperator:
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if oi, oj := order(names[i]), order(names[j]); oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func (pr *printer) print(ope Operator, minPrec int) {
+	if pos, ok := pr.starts[ope]; ok {
+		pr.writeComments(pr.commentsBefore(pos))
+	}
+
+	node := Inspect(ope)
+
+	prec := precPrimary
+	switch node.Kind {
+	case ChoiceNode:
+		prec = precChoice
+	case SequenceNode, ExpressionNode:
+		prec = precSequence
+	case AndPredicateNode, NotPredicateNode:
+		prec = precPrefix
+	case ZeroOrMoreNode, OneOrMoreNode, OptionNode:
+		prec = precSuffix
+	case IgnoreNode:
+		// Only references can be ignored in PEG text
+		pr.buf.WriteString("~")
+		if Inspect(node.Opes[0]).Kind == ReferenceNode {
+			pr.print(node.Opes[0], minPrec)
+			return
+		}
+		pr.buf.WriteString("(")
+		pr.print(node.Opes[0], precChoice)
+		pr.buf.WriteString(")")
+		if pr.err == nil {
+			pr.err = errors.New("ignores an operator other than a reference.")
+		}
+		return
+	case WhitespaceNode:
+		// The operand of whitespace is always ignored
+		if ign := Inspect(node.Opes[0]); ign.Kind == IgnoreNode {
+			pr.print(ign.Opes[0], minPrec)
+		} else {
+			pr.print(node.Opes[0], minPrec)
+		}
+		return
+	}
+
+	// Nested sequences and empty sequences need parentheses to keep their shape
+	paren := prec < minPrec || (node.Kind == SequenceNode && len(node.Opes) == 0 && minPrec > precChoice)
+	if paren {
+		pr.buf.WriteString("(")
+	}
+
+	switch node.Kind {
+	case ChoiceNode:
+		for i, o := range node.Opes {
+			if i > 0 {
+				pr.buf.WriteString(" / ")
+			}
+			pr.print(o, precSequence)
+		}
+	case SequenceNode:
+		for i, o := range node.Opes {
+			if i > 0 {
+				pr.buf.WriteString(" ")
+			}
+			pr.print(o, precPrefix)
+		}
+	case ExpressionNode:
+		atom, binop := node.Opes[0], node.Opes[1]
+		pr.print(atom, precPrefix)
+		pr.buf.WriteString(" (")
+		pr.print(binop, precPrefix)
+		pr.buf.WriteString(" ")
+		pr.print(atom, precPrefix)
+		pr.buf.WriteString(")*")
+	case AndPredicateNode:
+		pr.buf.WriteString("&")
+		pr.print(node.Opes[0], precSuffix)
+	case NotPredicateNode:
+		pr.buf.WriteString("!")
+		pr.print(node.Opes[0], precSuffix)
+	case ZeroOrMoreNode:
+		pr.print(node.Opes[0], precPrimary)
+		pr.buf.WriteString("*")
+	case OneOrMoreNode:
+		pr.print(node.Opes[0], precPrimary)
+		pr.buf.WriteString("+")
+	case OptionNode:
+		pr.print(node.Opes[0], precPrimary)
+		pr.buf.WriteString("?")
+	case LiteralNode:
+		pr.buf.WriteString("'")
+		pr.buf.WriteString(escapeGrammarText(node.Lit, '\''))
+		pr.buf.WriteString("'")
+	case ClassNode:
+		pr.buf.WriteString("[")
+		pr.buf.WriteString(escapeGrammarText(node.Chars, ']'))
+		pr.buf.WriteString("]")
+	case AnyCharacterNode:
+		pr.buf.WriteString(".")
+	case TokenBoundaryNode:
+		pr.buf.WriteString("< ")
+		pr.print(node.Opes[0], precChoice)
+		pr.buf.WriteString(" >")
+	case ReferenceNode:
+		pr.buf.WriteString(node.Name)
+		if node.Args != nil {
+			pr.buf.WriteString("(")
+			for i, arg := range node.Args {
+				if i > 0 {
+					pr.buf.WriteString(", ")
+				}
+				pr.print(arg, precChoice)
+			}
+			pr.buf.WriteString(")")
+		}
+	case RuleNode:
+		pr.buf.WriteString(node.Name)
+	case UserNode:
+		pr.buf.WriteString("%user")
+		if pr.err == nil {
+			pr.err = errors.New("contains a user defined operator.")
+		}
+	}
+
+	if paren {
+		pr.buf.WriteString(")")
+	}
+}
+
+// commentsBefore removes the pending comments starting before pos and
+// returns their text.
+func (pr *printer) commentsBefore(pos int) []string {
+	var cs []string
+	for len(pr.comments) > 0 && pr.comments[0].pos < pos {
+		c := pr.comments[0]
+		cs = append(cs, pr.src[c.pos:c.end])
+		pr.comments = pr.comments[1:]
+	}
+	return cs
+}
+
+// writeComments writes comments at the end of the current line, each one
+// followed by a line break.
+func (pr *printer) writeComments(cs []string) {
+	if len(cs) == 0 {
+		return
+	}
+	b := bytes.TrimRight(pr.buf.Bytes(), " ")
+	pr.buf.Truncate(len(b))
+	for _, c := range cs {
+		if n := pr.buf.Len(); n > 0 && pr.buf.Bytes()[n-1] != '\n' {
+			pr.buf.WriteString("  ")
+		}
+		pr.buf.WriteString(c)
+		pr.buf.WriteString("\n")
+	}
+}
+
+// escapeGrammarText escapes s for a literal or a class closed by delim.
+func escapeGrammarText(s string, delim byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case delim:
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
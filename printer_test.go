@@ -0,0 +1,342 @@
+package peg
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testGrammar is a grammar text passed to a parser constructor in the tests.
+type testGrammar struct {
+	text      string
+	userRules []string // Names of the user defined rules
+	mustParse bool     // The error of the constructor is discarded
+}
+
+// parse creates the parser of the grammar, with literals for the user
+// defined rules.
+func (g testGrammar) parse() (*Parser, error) {
+	rules := make(map[string]Operator)
+	for _, name := range g.userRules {
+		rules[name] = Lit(name)
+	}
+	return NewParserWithUserRules(g.text, rules)
+}
+
+// testGrammars returns the grammar texts passed to NewParser and
+// NewParserWithUserRules in the tests of the package.
+func testGrammars(t *testing.T) []testGrammar {
+	paths, err := filepath.Glob("*_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var grammars []testGrammar
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Constructors whose error is assigned to '_'
+		discarded := make(map[ast.Expr]bool)
+		ast.Inspect(f, func(n ast.Node) bool {
+			if as, ok := n.(*ast.AssignStmt); ok && len(as.Lhs) == 2 && len(as.Rhs) == 1 {
+				if ident, ok := as.Lhs[1].(*ast.Ident); ok && ident.Name == "_" {
+					discarded[as.Rhs[0]] = true
+				}
+			}
+			return true
+		})
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			ident, ok := call.Fun.(*ast.Ident)
+			if !ok || (ident.Name != "NewParser" && ident.Name != "NewParserWithUserRules") {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			text, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+
+			g := testGrammar{text: text, mustParse: discarded[call]}
+			if len(call.Args) == 2 {
+				rules, ok := call.Args[1].(*ast.CompositeLit)
+				if !ok {
+					return true
+				}
+				for _, elt := range rules.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						return true
+					}
+					key, ok := kv.Key.(*ast.BasicLit)
+					if !ok || key.Kind != token.STRING {
+						return true
+					}
+					name, _ := strconv.Unquote(key.Value)
+					g.userRules = append(g.userRules, name)
+				}
+			}
+			grammars = append(grammars, g)
+			return true
+		})
+	}
+	return grammars
+}
+
+// sameOperator reports whether two operators have the same structure,
+// ignoring positions. Rules inside operators are compared by name.
+func sameOperator(a, b Operator) bool {
+	na, nb := Inspect(a), Inspect(b)
+	if na.Kind != nb.Kind || na.Lit != nb.Lit || na.Chars != nb.Chars || na.Name != nb.Name || na.Param != nb.Param {
+		return false
+	}
+	if na.Kind == RuleNode {
+		return true
+	}
+	if len(na.Opes) != len(nb.Opes) || len(na.Args) != len(nb.Args) || (na.Args == nil) != (nb.Args == nil) {
+		return false
+	}
+	for i := range na.Opes {
+		if !sameOperator(na.Opes[i], nb.Opes[i]) {
+			return false
+		}
+	}
+	for i := range na.Args {
+		if !sameOperator(na.Args[i], nb.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameGrammar reports which rule of two parsers differs, if any.
+func sameGrammar(p1, p2 *Parser) (string, bool) {
+	if p1.Start() != p2.Start() || len(p1.Grammar) != len(p2.Grammar) {
+		return "", false
+	}
+	if !reflect.DeepEqual(p1.options, p2.options) {
+		return "---", false
+	}
+	for name, r1 := range p1.Grammar {
+		r2, ok := p2.Grammar[name]
+		if !ok || r1.Ignore != r2.Ignore || strings.Join(r1.Parameters, ",") != strings.Join(r2.Parameters, ",") ||
+			(r1.Parameters == nil) != (r2.Parameters == nil) || !sameOperator(r1.Ope, r2.Ope) {
+			return name, false
+		}
+	}
+	return "", true
+}
+
+func TestPrintGrammarRoundTrip(t *testing.T) {
+	count := 0
+	for _, g := range testGrammars(t) {
+		p1, err := g.parse()
+		if err != nil {
+			// Grammars the tests expect to be invalid
+			if g.mustParse {
+				t.Errorf("can't parse grammar:\n%s\n%v", g.text, err)
+			}
+			continue
+		}
+		count++
+
+		var b1 bytes.Buffer
+		if err := PrintGrammar(&b1, p1); err != nil {
+			t.Errorf("can't print grammar:\n%s\n%v", g.text, err)
+			continue
+		}
+
+		p2, err := NewParserWithUserRules(b1.String(), nil)
+		if err != nil {
+			t.Errorf("can't parse printed grammar:\n%s\n%v", b1.String(), err)
+			continue
+		}
+		if name, ok := sameGrammar(p1, p2); !ok {
+			t.Errorf("printed grammar differs in '%s':\n%s\n---\n%s", name, g.text, b1.String())
+		}
+	}
+	assert(t, count > 50)
+}
+
+func TestPrintIgnore(t *testing.T) {
+	assert(t, PrintOperator(Seq(Ign(Ref("A", nil, 0)), Ign(Seq(Lit("a"), Lit("b"))))) == "~A ~('a' 'b')")
+
+	b := NewGrammarBuilder()
+	b.Rule("START", Seq(Lit("a"), Ign(Lit("b"))))
+	p, err := b.Build()
+	assert(t, err == nil)
+
+	var buf bytes.Buffer
+	err = PrintGrammar(&buf, p)
+	assert(t, err != nil && err.Error() == "'START' ignores an operator other than a reference.")
+}
+
+func TestPrintGrammar(t *testing.T) {
+	parser, _ := NewParser(`
+		# Calculator
+		EXPR       ←  ATOM (BINOP ATOM)*
+		ATOM       ←  NUMBER / '(' EXPR ')'
+		BINOP      ←  < [-+/*] >
+		NUMBER     ←  < [0-9]+ > !(&'.' .)
+		~_         <- [ \t\]\\]* "'\n"
+		LIST(I, D) <- I (D I)*
+		%whitespace  ←  _?
+		---
+		%expr  = EXPR
+		%binop = L + -
+		%binop = L * /
+	`)
+
+	var b bytes.Buffer
+	assert(t, PrintGrammar(&b, parser) == nil)
+
+	want := `EXPR        <- ATOM (BINOP ATOM)*
+ATOM        <- NUMBER / '(' EXPR ')'
+BINOP       <- < [-+/*] >
+NUMBER      <- < [0-9]+ > !(&'.' .)
+~_          <- [ \t\]\\]* '\'\n'
+LIST(I, D)  <- I (D I)*
+%whitespace <- _?
+---
+%expr  = EXPR
+%binop = L + -
+%binop = L * /
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s", b.String())
+	}
+
+	assert(t, PrintOperator(Seq(Cho(Lit("a"), Seq()), Oom(Seq(Dot(), Npd(Lit("b")))))) == "('a' / ()) (. !'b')+")
+}
+
+func TestFormatGrammar(t *testing.T) {
+	src := `
+# Calculator
+
+EXPR ← ATOM  (BINOP ATOM)* # expression
+ATOM<-NUMBER
+  / '(' EXPR ')'   # nested
+# Tokens
+BINOP <-  < [-+/*] >
+
+
+NUMBER    <- < [0-9]+ >
+List(I,D) <- I (D I)*   # list
+# trailing
+---
+# Expression parsing
+%expr = EXPR
+%binop=L + -  # level 1
+`
+	want := `# Calculator
+
+EXPR  <- ATOM (BINOP ATOM)*  # expression
+ATOM  <- NUMBER
+      / '(' EXPR ')'  # nested
+# Tokens
+BINOP <- < [-+/*] >
+
+NUMBER     <- < [0-9]+ >
+List(I, D) <- I (D I)*  # list
+# trailing
+---
+# Expression parsing
+%expr  = EXPR
+%binop = L + -  # level 1
+`
+	got, err := FormatGrammar(src)
+	assert(t, err == nil)
+	if got != want {
+		t.Errorf("got:\n%s", got)
+	}
+}
+
+func TestFormatGrammarComments(t *testing.T) {
+	for _, test := range []struct{ src, want string }{
+		{
+			// Between operators and alternatives
+			"A <- 'a' # one\n  'b' # two\n  / 'c'\n",
+			"A <- 'a'  # one\n     'b'  # two\n  / 'c'\n",
+		},
+		{
+			// Before the first operator and after a prefix
+			"A <- # first\n ('a' # in\n 'b')* !# not\n 'c'\n",
+			"A <- # first\n     ('a'  # in\n     'b')* !  # not\n     'c'\n",
+		},
+		{
+			// On their own lines between alternatives
+			"A <- 'a'\n  / 'b'  # alt b\n  # before c\n\n  # and more\n  / 'c' # alt c\n",
+			"A <- 'a'\n  / 'b'  # alt b\n  # before c\n  # and more\n  / 'c'  # alt c\n",
+		},
+		{
+			// Inside macros and their arguments
+			"LIST(I, D) <- I (D # sep\n I)*\nB <- LIST('x' # item\n, ',') # end\n",
+			"LIST(I, D) <- I (D  # sep\n              I)*\nB          <- LIST('x',  # item\n              ',')  # end\n",
+		},
+	} {
+		got, err := FormatGrammar(test.src)
+		assert(t, err == nil)
+		if got != test.want {
+			t.Errorf("got:\n%s", got)
+		}
+
+		again, err := FormatGrammar(got)
+		assert(t, err == nil && again == got)
+
+		p1, _ := NewParser(test.src)
+		p2, err := NewParser(got)
+		assert(t, err == nil)
+		if name, ok := sameGrammar(p1, p2); !ok {
+			t.Errorf("formatted grammar differs in '%s':\n%s", name, got)
+		}
+	}
+}
+
+func TestFormatGrammarIdempotent(t *testing.T) {
+	for _, grammar := range testGrammars(t) {
+		if _, err := NewParser(grammar.text); err != nil {
+			continue
+		}
+
+		f1, err := FormatGrammar(grammar.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := FormatGrammar(f1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f1 != f2 {
+			t.Errorf("format not idempotent:\n%s\n---\n%s", f1, f2)
+		}
+
+		p1, _ := NewParser(grammar.text)
+		p2, err := NewParser(f1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b1, b2 bytes.Buffer
+		PrintGrammar(&b1, p1)
+		PrintGrammar(&b2, p2)
+		if b1.String() != b2.String() {
+			t.Errorf("formatted grammar differs:\n%s\n---\n%s", b1.String(), b2.String())
+		}
+	}
+}
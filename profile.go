@@ -0,0 +1,358 @@
+package peg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Profiler records how expensive the rules of a grammar are. It is an
+// Observer: set it as Parser.Observer and parse any number of inputs.
+type Profiler struct {
+	parser  *Parser
+	rules   map[*Rule]*RuleProfile
+	order   []*Rule
+	start   time.Time
+	elapsed time.Duration
+
+	stack   []profileFrame
+	active  map[*Rule]int          // Number of invocations of each rule on the stack
+	tried   map[backtrackKey]int   // Invocations of rules at positions in the current parse
+	counts  map[backtrackKey]int   // Re-invocations of rules at positions in all parses
+	samples map[string]*profSample // Samples of the pprof profile by call stack
+}
+
+// RuleProfile is the profile of a rule.
+type RuleProfile struct {
+	Name          string
+	Calls         int
+	Successes     int
+	Failures      int
+	Time          time.Duration // Time spent in the rule and the rules it calls
+	SelfTime      time.Duration // Time spent in the rule itself
+	Bytes         int           // Bytes consumed by successful matches
+	Reinvocations int           // Calls at a position where the rule was already tried in the same parse
+}
+
+// Backtrack is a position where a rule was tried more than once in a parse,
+// because the parser backtracked over it.
+type Backtrack struct {
+	Rule  string
+	Pos   int
+	Count int // Number of re-invocations
+}
+
+type backtrackKey struct {
+	rule *Rule
+	pos  int
+}
+
+type profileFrame struct {
+	rule  *Rule
+	start time.Time
+	child time.Duration // Time spent in nested rules
+}
+
+type profSample struct {
+	stack []*Rule // Innermost first
+	calls int64
+	time  int64
+}
+
+// NewProfiler returns a profiler for the grammar of p.
+func NewProfiler(p *Parser) *Profiler {
+	prof := &Profiler{
+		parser:  p,
+		rules:   make(map[*Rule]*RuleProfile),
+		active:  make(map[*Rule]int),
+		tried:   make(map[backtrackKey]int),
+		counts:  make(map[backtrackKey]int),
+		samples: make(map[string]*profSample),
+	}
+	for _, name := range p.RuleNames() {
+		r := p.Grammar[name]
+		prof.rules[r] = &RuleProfile{Name: name}
+		prof.order = append(prof.order, r)
+	}
+	return prof
+}
+
+func (prof *Profiler) Enter(ev *ParseEvent) {
+	if ev.Depth == 0 {
+		// A new parse
+		prof.tried = make(map[backtrackKey]int)
+		prof.active = make(map[*Rule]int)
+		prof.stack = prof.stack[:0]
+		prof.start = time.Now()
+	}
+	if ev.Rule == nil {
+		return
+	}
+	if _, ok := prof.rules[ev.Rule]; !ok {
+		return
+	}
+
+	key := backtrackKey{ev.Rule, ev.Pos}
+	if prof.tried[key] > 0 {
+		prof.rules[ev.Rule].Reinvocations++
+		prof.counts[key]++
+	}
+	prof.tried[key]++
+
+	prof.active[ev.Rule]++
+	prof.stack = append(prof.stack, profileFrame{rule: ev.Rule, start: time.Now()})
+}
+
+func (prof *Profiler) Leave(ev *ParseEvent) {
+	if ev.Rule != nil && len(prof.stack) > 0 && prof.stack[len(prof.stack)-1].rule == ev.Rule {
+		frame := prof.stack[len(prof.stack)-1]
+		prof.stack = prof.stack[:len(prof.stack)-1]
+		elapsed := time.Since(frame.start)
+		self := elapsed - frame.child
+		if len(prof.stack) > 0 {
+			prof.stack[len(prof.stack)-1].child += elapsed
+		}
+
+		rp := prof.rules[ev.Rule]
+		rp.Calls++
+		if ev.Success() {
+			rp.Successes++
+			rp.Bytes += ev.Len
+		} else {
+			rp.Failures++
+		}
+		rp.SelfTime += self
+
+		// Time of recursive calls is already counted by the outermost one
+		prof.active[ev.Rule]--
+		if prof.active[ev.Rule] == 0 {
+			rp.Time += elapsed
+		}
+
+		prof.addSample(frame.rule, self)
+	}
+
+	if ev.Depth == 0 {
+		prof.elapsed += time.Since(prof.start)
+	}
+}
+
+func (prof *Profiler) addSample(r *Rule, self time.Duration) {
+	stack := []*Rule{r}
+	for i := len(prof.stack) - 1; i >= 0; i-- {
+		stack = append(stack, prof.stack[i].rule)
+	}
+
+	var key strings.Builder
+	for _, r := range stack {
+		key.WriteString(r.Name)
+		key.WriteByte(0)
+	}
+	sample, ok := prof.samples[key.String()]
+	if !ok {
+		sample = &profSample{stack: stack}
+		prof.samples[key.String()] = sample
+	}
+	sample.calls++
+	sample.time += int64(self)
+}
+
+// Rules returns the profiles of the rules that were called, the most
+// expensive first.
+func (prof *Profiler) Rules() []*RuleProfile {
+	var rules []*RuleProfile
+	for _, r := range prof.order {
+		if rp := prof.rules[r]; rp.Calls > 0 {
+			rules = append(rules, rp)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Time != rules[j].Time {
+			return rules[i].Time > rules[j].Time
+		}
+		return rules[i].Calls > rules[j].Calls
+	})
+	return rules
+}
+
+// Backtracks returns the positions where rules were re-invoked, the most
+// frequent first.
+func (prof *Profiler) Backtracks() []Backtrack {
+	var bts []Backtrack
+	for key, count := range prof.counts {
+		bts = append(bts, Backtrack{key.rule.Name, key.pos, count})
+	}
+	sort.Slice(bts, func(i, j int) bool {
+		if bts[i].Count != bts[j].Count {
+			return bts[i].Count > bts[j].Count
+		}
+		if bts[i].Pos != bts[j].Pos {
+			return bts[i].Pos < bts[j].Pos
+		}
+		return bts[i].Rule < bts[j].Rule
+	})
+	return bts
+}
+
+// WriteTable writes the profiles of the rules as a table, the most expensive
+// first.
+func (prof *Profiler) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "calls\tsuccess\tfail\ttime\tself\tbytes\treinvoked\t rule")
+	for _, rp := range prof.Rules() {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%v\t%v\t%d\t%d\t %s\n",
+			rp.Calls, rp.Successes, rp.Failures, rp.Time, rp.SelfTime, rp.Bytes, rp.Reinvocations, rp.Name)
+	}
+	return tw.Flush()
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format of
+// pprof. The functions of the profile are the rules, with the grammar as
+// their file, and its sample values are the calls and the self time of the
+// rules for each stack of rules.
+func (prof *Profiler) WritePprof(w io.Writer) error {
+	var pb protoBuffer
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return int64(i)
+		}
+		strs[s] = len(table)
+		table = append(table, s)
+		return int64(len(table) - 1)
+	}
+
+	valueType := func(typ, unit string) []byte {
+		var vt protoBuffer
+		vt.int64(1, str(typ))
+		vt.int64(2, str(unit))
+		return vt.bytes()
+	}
+	pb.message(1, valueType("calls", "count"))
+	pb.message(1, valueType("time", "nanoseconds"))
+
+	// Samples in a stable order
+	keys := make([]string, 0, len(prof.samples))
+	for key := range prof.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ids := make(map[*Rule]uint64)
+	for _, r := range prof.order {
+		ids[r] = uint64(len(ids) + 1)
+	}
+	for _, key := range keys {
+		sample := prof.samples[key]
+		var locs []uint64
+		for _, r := range sample.stack {
+			locs = append(locs, ids[r])
+		}
+		var sp protoBuffer
+		sp.packedUint64(1, locs)
+		sp.packedInt64(2, []int64{sample.calls, sample.time})
+		pb.message(2, sp.bytes())
+	}
+
+	for _, r := range prof.order {
+		var line protoBuffer
+		line.uint64(1, ids[r])
+		var loc protoBuffer
+		loc.uint64(1, ids[r])
+		if r.SS != "" {
+			ln, _ := lineInfo(r.SS, r.Pos)
+			line.int64(2, int64(ln))
+		}
+		loc.message(4, line.bytes())
+		pb.message(4, loc.bytes())
+	}
+
+	for _, r := range prof.order {
+		var fn protoBuffer
+		fn.uint64(1, ids[r])
+		fn.int64(2, str(r.Name))
+		fn.int64(3, str(r.Name))
+		fn.int64(4, str("grammar"))
+		if r.SS != "" {
+			ln, _ := lineInfo(r.SS, r.Pos)
+			fn.int64(5, int64(ln))
+		}
+		pb.message(5, fn.bytes())
+	}
+
+	pb.int64(10, int64(prof.elapsed))
+	pb.message(11, valueType("calls", "count"))
+	pb.int64(12, 1)
+
+	// The string table is written last, when all strings are known
+	for _, s := range table {
+		pb.message(6, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(pb.bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer encodes protocol buffer messages.
+type protoBuffer struct {
+	b bytes.Buffer
+}
+
+func (pb *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		pb.b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	pb.b.WriteByte(byte(x))
+}
+
+func (pb *protoBuffer) key(field int, wireType int) {
+	pb.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (pb *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	pb.key(field, 0)
+	pb.varint(x)
+}
+
+func (pb *protoBuffer) int64(field int, x int64) {
+	pb.uint64(field, uint64(x))
+}
+
+func (pb *protoBuffer) message(field int, b []byte) {
+	pb.key(field, 2)
+	pb.varint(uint64(len(b)))
+	pb.b.Write(b)
+}
+
+func (pb *protoBuffer) packedUint64(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	pb.message(field, packed.bytes())
+}
+
+func (pb *protoBuffer) packedInt64(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	pb.message(field, packed.bytes())
+}
+
+func (pb *protoBuffer) bytes() []byte {
+	return pb.b.Bytes()
+}
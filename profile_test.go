@@ -0,0 +1,124 @@
+package peg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- A 'x' / A 'y' / LIST
+        A    <- 'a'
+        LIST <- '(' LIST* ')'
+    `)
+	prof := NewProfiler(p)
+	p.Observer = prof
+
+	assert(t, p.Parse("ay", nil) == nil)
+	assert(t, p.Parse("(())", nil) == nil)
+
+	rules := make(map[string]*RuleProfile)
+	for _, rp := range prof.Rules() {
+		rules[rp.Name] = rp
+	}
+	assert(t, len(rules) == 3)
+
+	a := rules["A"]
+	assert(t, a.Calls == 4 && a.Successes == 2 && a.Failures == 2)
+	assert(t, a.Bytes == 2)
+	assert(t, a.Reinvocations == 2)
+
+	list := rules["LIST"]
+	assert(t, list.Calls == 4 && list.Successes == 2 && list.Failures == 2)
+	assert(t, list.Bytes == 6)
+	assert(t, list.Reinvocations == 0)
+	assert(t, list.Time <= rules["ROOT"].Time)
+	assert(t, list.SelfTime <= list.Time)
+
+	bts := prof.Backtracks()
+	assert(t, len(bts) == 1)
+	assert(t, bts[0] == Backtrack{"A", 0, 2})
+
+	var b bytes.Buffer
+	if err := prof.WriteTable(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	assert(t, len(lines) == 4)
+	assert(t, strings.HasSuffix(lines[0], "reinvoked rule"))
+	assert(t, strings.HasSuffix(lines[1], " ROOT"))
+}
+
+// protoFields returns the values of the length-delimited fields of a
+// protocol buffer message by field number.
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	varint := func() uint64 {
+		var x uint64
+		for shift := uint(0); ; shift += 7 {
+			c := b[0]
+			b = b[1:]
+			x |= uint64(c&0x7f) << shift
+			if c < 0x80 {
+				return x
+			}
+		}
+	}
+
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		key := varint()
+		switch key & 7 {
+		case 0:
+			varint()
+		case 2:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], b[:n])
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestProfilerPprof(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- A 'x' / A 'y'
+        A    <- 'a'
+    `)
+	prof := NewProfiler(p)
+	p.Observer = prof
+	p.Parse("ay", nil)
+
+	var b bytes.Buffer
+	if err := prof.WritePprof(&b); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := protoFields(t, data)
+	assert(t, len(fields[1]) == 2) // Sample types
+	assert(t, len(fields[2]) == 2) // Samples: ROOT and A called from ROOT
+	assert(t, len(fields[4]) == 2) // Locations
+	assert(t, len(fields[5]) == 2) // Functions
+
+	var strs []string
+	for _, s := range fields[6] {
+		strs = append(strs, string(s))
+	}
+	assert(t, strs[0] == "")
+	table := strings.Join(strs, " ")
+	for _, s := range []string{"calls", "nanoseconds", "ROOT", "A", "grammar"} {
+		assert(t, strings.Contains(table, s))
+	}
+}
@@ -0,0 +1,206 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Reduce shrinks input while keep returns true for it, to get a small input
+// for a bug report. keep must return true for input. The reduction is aware
+// of the grammar: it first removes the text matched by rules, largest first,
+// so whole subtrees go at once, then lines and characters with the delta
+// debugging algorithm.
+func Reduce(p *Parser, input string, keep func(s string) bool) string {
+	s := input
+
+	for reduced := true; reduced; {
+		reduced = false
+		for _, sp := range ruleSpans(p, s) {
+			t := s[:sp.pos] + s[sp.end:]
+			if keep(t) {
+				s = t
+				reduced = true
+				break
+			}
+		}
+	}
+
+	s = strings.Join(ddmin(strings.SplitAfter(s, "\n"), keep), "")
+	s = strings.Join(ddmin(strings.Split(s, ""), keep), "")
+	return s
+}
+
+// ruleSpans returns the spans of the text matched by rules in a parse of s,
+// the longest first.
+func ruleSpans(p *Parser, s string) []sourceSpan {
+	so := &spanObserver{seen: make(map[sourceSpan]bool)}
+	observeParse(p, s, so)
+	sort.SliceStable(so.spans, func(i, j int) bool {
+		return so.spans[i].end-so.spans[i].pos > so.spans[j].end-so.spans[j].pos
+	})
+	return so.spans
+}
+
+// spanObserver records the spans of the text matched by rules.
+type spanObserver struct {
+	seen  map[sourceSpan]bool
+	spans []sourceSpan
+}
+
+func (so *spanObserver) Enter(ev *ParseEvent) {}
+
+func (so *spanObserver) Leave(ev *ParseEvent) {
+	if ev.Rule == nil || ev.Len <= 0 {
+		return
+	}
+	sp := sourceSpan{ev.Pos, ev.Pos + ev.Len}
+	if !so.seen[sp] {
+		so.seen[sp] = true
+		so.spans = append(so.spans, sp)
+	}
+}
+
+// ddmin removes units as long as keep returns true for the rest joined,
+// trying chunks of halving sizes.
+func ddmin(units []string, keep func(s string) bool) []string {
+	n := 2
+	for len(units) > 0 {
+		if n > len(units) {
+			n = len(units)
+		}
+		chunk := (len(units) + n - 1) / n
+
+		reduced := false
+		for start := 0; start < len(units); start += chunk {
+			end := start + chunk
+			if end > len(units) {
+				end = len(units)
+			}
+			rest := append(append([]string{}, units[:start]...), units[end:]...)
+			if keep(strings.Join(rest, "")) {
+				units = rest
+				if n > 2 {
+					n--
+				}
+				reduced = true
+				break
+			}
+		}
+
+		if !reduced {
+			if n == len(units) {
+				break
+			}
+			n *= 2
+		}
+	}
+	return units
+}
+
+// SameFailure returns a predicate for Reduce reporting whether a parse with
+// p fails like the parse of input: with a panic of the same value, or with an
+// error of the same message at the same rule, the innermost rule being parsed
+// when the parser reached the farthest error position. The observer of p is
+// notified of the parses.
+func SameFailure(p *Parser, input string) (func(s string) bool, error) {
+	failure := func(s string) (rule, msg string, failed bool) {
+		fo := &failureObserver{}
+		err, panicked := observeParse(p, s, fo)
+		if panicked != nil {
+			return "", fmt.Sprintf("panic: %v", panicked), true
+		}
+		if err == nil {
+			return "", "", false
+		}
+		switch e := err.(type) {
+		case *Error:
+			// Errors of actions may have no details
+			if len(e.Details) > 0 {
+				msg = e.Details[0].Msg
+			}
+		case *SyntaxError:
+			if len(e.BaseError.Details) > 0 {
+				msg = e.BaseError.Details[0].Msg
+			}
+		default:
+			msg = err.Error()
+		}
+		return fo.rule, msg, true
+	}
+
+	rule, msg, failed := failure(input)
+	if !failed {
+		return nil, errors.New("the input doesn't fail.")
+	}
+	return func(s string) bool {
+		r, m, f := failure(s)
+		return f && r == rule && m == msg
+	}, nil
+}
+
+// observeParse parses s with p notifying o after the observer of p, and
+// returns the error or the value of a panic.
+func observeParse(p *Parser, s string, o Observer) (err error, panicked interface{}) {
+	observer := p.Observer
+	p.Observer = MultiObserver(observer, o)
+	defer func() {
+		p.Observer = observer
+		if r := recover(); r != nil {
+			panicked = r
+		}
+	}()
+	err = p.Parse(s, nil)
+	return
+}
+
+// failureObserver records the innermost rule being parsed when the parser
+// reached the farthest error position, not counting the whitespace and word
+// rules, which are tried at the end of most tokens.
+type failureObserver struct {
+	stack    []string
+	skip     int // Number of whitespace and word rules in the stack
+	errorPos int
+	rule     string
+}
+
+func (fo *failureObserver) Enter(ev *ParseEvent) {
+	if ev.Depth == 0 {
+		fo.stack = fo.stack[:0]
+		fo.skip = 0
+		fo.errorPos = -1
+		fo.rule = ""
+	}
+	fo.update(ev)
+	if ev.Rule != nil {
+		fo.stack = append(fo.stack, ev.Rule.Name)
+		if isSpacingRule(ev.Rule.Name) {
+			fo.skip++
+		}
+	}
+}
+
+func (fo *failureObserver) Leave(ev *ParseEvent) {
+	fo.update(ev)
+	if ev.Rule != nil && len(fo.stack) > 0 {
+		fo.stack = fo.stack[:len(fo.stack)-1]
+		if isSpacingRule(ev.Rule.Name) {
+			fo.skip--
+		}
+	}
+}
+
+func (fo *failureObserver) update(ev *ParseEvent) {
+	if fo.skip > 0 || len(fo.stack) == 0 {
+		return
+	}
+	if pos := ev.ErrorPos(); pos > fo.errorPos {
+		fo.errorPos = pos
+		fo.rule = fo.stack[len(fo.stack)-1]
+	}
+}
+
+func isSpacingRule(name string) bool {
+	return name == WhitespceRuleName || name == WordRuleName
+}
@@ -0,0 +1,103 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+const reduceGrammar = `
+    PROGRAM     <- STATEMENT* EOF
+    STATEMENT   <- 'let' NAME '=' EXPR ';' / 'print' EXPR ';'
+    EXPR        <- TERM ('+' TERM)*
+    TERM        <- NUMBER / NAME / '(' EXPR ')'
+    NAME        <- < [a-z]+ >
+    NUMBER      <- < [0-9]+ >
+    EOF         <- !.
+    %whitespace <- [ \t\n]*
+`
+
+func TestReduce(t *testing.T) {
+	p, _ := NewParser(reduceGrammar)
+
+	input := `let a = 1 + (2 + b);
+print a + 3;
+let c = (a + (4 + 5)) + 6;
+print (c + );
+print c;
+`
+	keep, err := SameFailure(p, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	s := Reduce(p, input, func(s string) bool {
+		calls++
+		return keep(s)
+	})
+	if s != "print(c+)" {
+		t.Errorf("reduced to %q", s)
+	}
+	assert(t, keep(s))
+	assert(t, calls < 500)
+}
+
+func TestReducePanic(t *testing.T) {
+	p, _ := NewParser(reduceGrammar)
+	p.Grammar["NUMBER"].Action = func(v *Values, d Any) (Any, error) {
+		if v.Token() == "13" {
+			panic("unlucky")
+		}
+		return nil, nil
+	}
+
+	input := "let a = 1 + 2;\nprint (a + 13) + 3;\nprint a;\n"
+	keep, err := SameFailure(p, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Reduce(p, input, keep)
+	if s != "print13" {
+		t.Errorf("reduced to %q", s)
+	}
+	assert(t, !keep("12"))
+	assert(t, p.Observer == nil)
+}
+
+func TestSameFailure(t *testing.T) {
+	p, _ := NewParser(reduceGrammar)
+
+	_, err := SameFailure(p, "print 1;")
+	assert(t, err != nil)
+
+	keep, _ := SameFailure(p, "print (1 + );")
+	assert(t, keep("print (2 + );"))
+	assert(t, !keep("print 1;"))
+	assert(t, !keep("print 1 +;")) // Same message in TERM, but not in parentheses
+	assert(t, !keep("let = 1;"))   // Error in NAME
+}
+
+func TestSameFailureActionError(t *testing.T) {
+	p, _ := NewParser(`ROOT <- 'a'+`)
+	p.Grammar["ROOT"].Action = func(v *Values, d Any) (Any, error) {
+		if len(v.S) > 1 {
+			return nil, &Error{}
+		}
+		return nil, nil
+	}
+	o := &countObserver{}
+	p.Observer = o
+
+	keep, err := SameFailure(p, "aaa")
+	assert(t, err == nil)
+	assert(t, keep("aa"))
+	assert(t, !keep("a"))
+	assert(t, o.enter > 0)
+	assert(t, p.Observer == o)
+}
+
+func TestDdmin(t *testing.T) {
+	keep := func(s string) bool { return strings.Contains(s, "x") && strings.Contains(s, "z") }
+	units := ddmin(strings.Split("abcxdefghzij", ""), keep)
+	assert(t, strings.Join(units, "") == "xz")
+}
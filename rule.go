@@ -70,6 +70,16 @@ func (e *Error) GetSuggestions() []string {
 type SyntaxError struct {
 	BaseError Error
 	Expected  []string
+
+	// Input and trial parser for input-aware suggestions
+	input string
+	pos   int
+	trial func(s string) int
+	ln    int // Line and column of the beginning of input
+	col   int
+
+	suggestions []string
+	computed    bool
 }
 
 // Implement the error interface for SyntaxError
@@ -77,8 +87,20 @@ func (e *SyntaxError) Error() string {
 	return e.BaseError.Error()
 }
 
-// GetSuggestions provides helpful suggestions based on error context for SyntaxError
+// GetSuggestions provides helpful suggestions based on error context for
+// SyntaxError. It compares the input at the error position with the expected
+// literals, looks for delimiters that aren't closed, and tries small repairs
+// of the input that let parsing get further. Each repair is tried with a parse
+// of the whole input, without actions; at most 8 are tried, and none for
+// inputs longer than 64 KiB. So repairs are only checked against the grammar:
+// the actions, Enter and Leave aren't run on them, and an action can still
+// reject a repaired input. The suggestions are computed on the first call.
 func (e *SyntaxError) GetSuggestions() []string {
+	if !e.computed {
+		e.suggestions = e.inputSuggestions()
+		e.computed = true
+	}
+
 	var suggestions []string
 
 	// Add suggestions based on expected tokens
@@ -86,6 +108,10 @@ func (e *SyntaxError) GetSuggestions() []string {
 		suggestions = append(suggestions, fmt.Sprintf("Expected one of: %s", strings.Join(e.Expected, ", ")))
 	}
 
+	if len(e.suggestions) > 0 {
+		return append(suggestions, e.suggestions...)
+	}
+
 	// Add general suggestions
 	suggestions = append(suggestions, "Check if you have the correct syntax for this expression")
 	suggestions = append(suggestions, "Verify that your grammar rules are correctly defined")
@@ -93,10 +119,14 @@ func (e *SyntaxError) GetSuggestions() []string {
 	return suggestions
 }
 
+// GrammarError is an error in a grammar. BaseError has the details of all
+// problems found, and RuleName and ErrorType describe the first one.
 type GrammarError struct {
 	BaseError Error
 	RuleName  string
 	ErrorType string // e.g., "left recursion", "undefined rule", etc.
+
+	suggestions []string
 }
 
 // Implement the error interface for GrammarError
@@ -104,6 +134,12 @@ func (e *GrammarError) Error() string {
 	return e.BaseError.Error()
 }
 
+// GetSuggestions provides suggestions for fixing the grammar, like rule names
+// similar to an undefined one.
+func (e *GrammarError) GetSuggestions() []string {
+	return e.suggestions
+}
+
 // Action
 type Action func(v *Values, d Any) (Any, error)
 
@@ -112,39 +148,62 @@ type Rule struct {
 	Name          string
 	SS            string
 	Pos           int
-	Ope           operator
+	Ope           Operator
 	Action        Action
 	Enter         func(d Any)
 	Leave         func(d Any)
 	Message       func() (message string)
 	Ignore        bool
-	WhitespaceOpe operator
-	WordOpe       operator
+	WhitespaceOpe Operator
+	WordOpe       Operator
 
 	Parameters []string
 
+	// Text of the comment lines right before the definition in the grammar,
+	// without the '#' marks. The comment lines at the top of the grammar are
+	// its header.
+	Doc string
+
 	TracerEnter func(name string, s string, v *Values, d Any, p int)
 	TracerLeave func(name string, s string, v *Values, d Any, p int, l int)
+	Observer    Observer
 
 	tokenChecker  *tokenChecker
 	disableAction bool
+	trialAction   bool // Action invoked in trial parses too
+	packrat       bool // Memoize the results of rules in parses with this rule
 }
 
 func (r *Rule) Parse(s string, d Any) (l int, val Any, err error) {
-	v := &Values{}
-	c := &context{
+	c := r.newContext(s)
+	l, val = r.parseInContext(s, d, c)
+	if fail(l) || l != len(s) {
+		err = c.newError(s, l, r)
+	}
+	return
+}
+
+func (r *Rule) newContext(s string) *context {
+	return &context{
 		s:             s,
 		errorPos:      -1,
 		messagePos:    -1,
+		outerErrorPos: -1,
 		whitespaceOpe: r.WhitespaceOpe,
 		wordOpe:       r.WordOpe,
 		tracerEnter:   r.TracerEnter,
 		tracerLeave:   r.TracerLeave,
+		observer:      r.Observer,
+		memo:          newMemo(r.packrat),
 	}
+}
+
+func (r *Rule) parseInContext(s string, d Any, c *context) (l int, val Any) {
+	v := &Values{}
 
-	var ope operator = r
-	if r.WhitespaceOpe != nil {
-		ope = Seq(r.WhitespaceOpe, r) // Skip whitespace at beginning
+	var ope Operator = r
+	if c.whitespaceOpe != nil {
+		ope = Seq(c.whitespaceOpe, r) // Skip whitespace at beginning
 	}
 
 	l = ope.parse(s, 0, v, c, d)
@@ -152,54 +211,57 @@ func (r *Rule) Parse(s string, d Any) (l int, val Any, err error) {
 	if success(l) && len(v.Vs) > 0 && v.Vs[0] != nil {
 		val = v.Vs[0]
 	}
+	return
+}
 
-	if fail(l) || l != len(s) {
-		var pos int
-		var msg string
-		var line string
-		if fail(l) {
-			if c.messagePos > -1 {
-				pos = c.messagePos
-				msg = c.message
+// newError creates the error for a parse of s with rule r that ended with
+// length l.
+func (c *context) newError(s string, l int, r *Rule) error {
+	var pos int
+	var msg string
+	var line string
+	if fail(l) {
+		if c.messagePos > -1 {
+			pos = c.messagePos
+			msg = c.message
+		} else {
+			pos = c.errorPos
+			ln, _ := lineInfo(s, pos)
+			lineStart, lineEnd := printLine(s, ln)
+			line = s[lineStart:lineEnd]
+
+			// Enhanced error message with expected tokens
+			if len(c.expectedTokens) > 0 {
+				msg = fmt.Sprintf("Syntax error: expected %s", strings.Join(c.expectedTokens, ", "))
 			} else {
-				pos = c.errorPos
-				ln, _ := lineInfo(s, pos)
-				lineStart, lineEnd := printLine(s, ln)
-				line = s[lineStart:lineEnd]
-
-				// Enhanced error message with expected tokens
-				if len(c.expectedTokens) > 0 {
-					msg = fmt.Sprintf("Syntax error: expected %s", strings.Join(c.expectedTokens, ", "))
-				} else {
-					msg = "Syntax error"
-				}
+				msg = "Syntax error"
 			}
-		} else {
-			msg = "not exact match"
-			pos = l
-		}
-		ln, col := lineInfo(s, pos)
-
-		// Create appropriate error type
-		syntaxErr := &Error{
-			Type: SyntaxErrorType,
 		}
+	} else {
+		msg = "not exact match"
+		pos = l
+	}
+	ln, col := lineInfo(s, pos)
 
-		if strings.Contains(msg, "expected") {
-			syntaxErr.Details = append(syntaxErr.Details, ErrorDetail{ln, col, msg, line})
-			err = &SyntaxError{
-				BaseError: *syntaxErr,
-				Expected:  c.expectedTokens,
-			}
-		} else {
-			syntaxErr.Details = append(syntaxErr.Details, ErrorDetail{ln, col, msg, line})
-			err = syntaxErr
+	// Create appropriate error type
+	syntaxErr := &Error{
+		Type: SyntaxErrorType,
+	}
+	syntaxErr.Details = append(syntaxErr.Details, ErrorDetail{ln, col, msg, line})
+
+	if strings.Contains(msg, "expected") {
+		ws, word := c.whitespaceOpe, c.wordOpe
+		return &SyntaxError{
+			BaseError: *syntaxErr,
+			Expected:  c.expectedTokens,
+			input:     s,
+			pos:       pos,
+			trial:     func(s string) int { return trialParse(r, ws, word, s) },
+			ln:        1,
+			col:       1,
 		}
-
-		// Details are already added to the error
 	}
-
-	return
+	return syntaxErr
 }
 
 func printLine(s string, line int) (int, int) {
@@ -235,7 +297,15 @@ func (r *Rule) parseCore(s string, p int, v *Values, c *context, d Any) int {
 		return r.Ope.parse(s, p, v, c, d)
 	}
 
-	if r.Enter != nil {
+	// The operator of an expression is read by the action, which must run
+	if c.memo != nil && !r.trialAction {
+		return c.parseMemoized(r, s, p, v, d)
+	}
+	return r.parseRule(s, p, v, c, d)
+}
+
+func (r *Rule) parseRule(s string, p int, v *Values, c *context, d Any) int {
+	if r.Enter != nil && !c.noActions {
 		r.Enter(d)
 	}
 
@@ -247,7 +317,7 @@ func (r *Rule) parseCore(s string, p int, v *Values, c *context, d Any) int {
 	var val Any
 
 	if success(l) {
-		if r.Action != nil && !r.disableAction {
+		if r.Action != nil && !r.disableAction && (!c.noActions || r.trialAction) {
 			chv.S = s[p : p+l]
 			chv.Pos = p
 
@@ -272,20 +342,28 @@ func (r *Rule) parseCore(s string, p int, v *Values, c *context, d Any) int {
 		if r.Message != nil {
 			if c.messagePos < p {
 				c.messagePos = p
-				c.message = r.Message()
+				c.message = r.message(c)
 			}
 		}
 	}
 
 	c.pop()
 
-	if r.Leave != nil {
+	if r.Leave != nil && !c.noActions {
 		r.Leave(d)
 	}
 
 	return l
 }
 
+// message calls the Message hook of the rule.
+func (r *Rule) message(c *context) string {
+	if c.noActions {
+		defer abortTrial()
+	}
+	return r.Message()
+}
+
 func (r *Rule) accept(v visitor) {
 	v.visitRule(r)
 }
@@ -312,7 +390,7 @@ func lineInfo(s string, curPos int) (ln int, col int) {
 	colStartPos := 0
 	ln = 1
 
-	for pos < curPos {
+	for pos < curPos && pos < len(s) {
 		if s[pos] == '\n' {
 			ln++
 			colStartPos = pos + 1
@@ -0,0 +1,343 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+)
+
+// Cost of a rule that can't be derived to a string
+const sampleInfinity = 1 << 30
+
+// SampleGenerator produces random strings accepted by a grammar, for fuzzing
+// the code using the parser. It walks the operators of the rules and makes
+// random choices, then checks the string with the parser, without invoking
+// actions, as predicates may reject it. Whitespace is inserted where the
+// grammar skips it.
+type SampleGenerator struct {
+	// Depth of the rules after which the generator takes the shortest way
+	// to finish the string
+	MaxDepth int
+	// Maximum number of repetitions of '*' and '+'
+	MaxRepeat int
+	// Length of the string after which the generator takes the shortest way
+	// to finish it
+	MaxLength int
+	// Number of strings tried for a sample before giving up
+	MaxTries int
+	// Weights of the alternatives of the choice defining a rule, by rule
+	// name. Alternatives without a weight have the weight 1.
+	Weights map[string][]float64
+	Rand    *rand.Rand
+
+	parser *Parser
+	costs  map[*Rule]int
+	sep    string // String matching the whitespace, inserted where it's skipped
+}
+
+// State of the generation of a string
+type sampleState struct {
+	b       bytes.Buffer
+	depth   int
+	inToken bool
+	failed  bool
+}
+
+// NewSampleGenerator returns a generator for the grammar of p, making choices
+// with a random source seeded with seed.
+func NewSampleGenerator(p *Parser, seed int64) *SampleGenerator {
+	g := &SampleGenerator{
+		MaxDepth:  12,
+		MaxRepeat: 3,
+		MaxLength: 1024,
+		MaxTries:  100,
+		Rand:      rand.New(rand.NewSource(seed)),
+		parser:    p,
+		costs:     make(map[*Rule]int),
+	}
+
+	// Number of rules the shortest string of each rule goes through, which
+	// is computed until it doesn't change anymore
+	for _, r := range p.Grammar {
+		g.costs[r] = sampleInfinity
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, r := range p.Grammar {
+			if cost := g.cost(r.Ope) + 1; cost < g.costs[r] {
+				g.costs[r] = cost
+				changed = true
+			}
+		}
+	}
+
+	if ws := p.Grammar[p.start].WhitespaceOpe; ws != nil {
+		for _, sep := range []string{" ", "\n", "\t"} {
+			c := &context{s: sep, errorPos: -1, messagePos: -1, noActions: true}
+			if ws.parse(sep, 0, &Values{}, c, nil) == len(sep) {
+				g.sep = sep
+				break
+			}
+		}
+	}
+	return g
+}
+
+// Sample returns a random string accepted by the start rule.
+func (g *SampleGenerator) Sample() (string, error) {
+	return g.SampleRule(g.parser.start)
+}
+
+// SampleRule returns a random string accepted by the rule.
+func (g *SampleGenerator) SampleRule(name string) (string, error) {
+	r, ok := g.parser.Grammar[name]
+	if !ok {
+		return "", errors.New("'" + name + "' is not defined.")
+	}
+	if r.Parameters != nil {
+		return "", errors.New("'" + name + "' is a macro.")
+	}
+
+	start := g.parser.Grammar[g.parser.start]
+	accepts := func(s string) bool {
+		return trialParse(r, start.WhitespaceOpe, start.WordOpe, s) == len(s)+1
+	}
+
+	for i := 0; i < g.MaxTries; i++ {
+		st := &sampleState{}
+		g.genRule(st, r, nil)
+		if st.failed {
+			continue
+		}
+		s := st.b.String()
+		if g.sep != "" && len(s) > len(g.sep) && s[len(s)-len(g.sep):] == g.sep && accepts(s[:len(s)-len(g.sep)]) {
+			return s[:len(s)-len(g.sep)], nil
+		}
+		if accepts(s) {
+			return s, nil
+		}
+	}
+	return "", errors.New("can't generate a string accepted by '" + name + "'.")
+}
+
+// short reports whether the generator should take the shortest way to finish
+// the string.
+func (g *SampleGenerator) short(st *sampleState) bool {
+	return st.depth > g.MaxDepth || st.b.Len() > g.MaxLength
+}
+
+func (g *SampleGenerator) genRule(st *sampleState, r *Rule, env *macroEnv) {
+	// Derivations that don't get shorter, through macros, are given up
+	if st.depth > g.MaxDepth+maxMacroDepth {
+		st.failed = true
+		return
+	}
+
+	st.depth++
+	if node := Inspect(r.Ope); node.Kind == ChoiceNode {
+		g.genChoice(st, node.Opes, g.Weights[r.Name], env)
+	} else {
+		g.gen(st, r.Ope, env)
+	}
+	st.depth--
+}
+
+func (g *SampleGenerator) genChoice(st *sampleState, opes []Operator, weights []float64, env *macroEnv) {
+	weight := func(i int) float64 {
+		if i < len(weights) {
+			return weights[i]
+		}
+		return 1
+	}
+
+	var candidates []int
+	if g.short(st) {
+		min := sampleInfinity
+		for i, o := range opes {
+			if cost := g.cost(o); cost < min {
+				min = cost
+				candidates = []int{i}
+			} else if cost == min {
+				candidates = append(candidates, i)
+			}
+		}
+		g.gen(st, opes[candidates[g.Rand.Intn(len(candidates))]], env)
+		return
+	}
+
+	total := 0.0
+	for i := range opes {
+		total += weight(i)
+	}
+	if total <= 0 {
+		st.failed = true
+		return
+	}
+	x := g.Rand.Float64() * total
+	i := 0
+	for ; i < len(opes)-1; i++ {
+		if x -= weight(i); x < 0 {
+			break
+		}
+	}
+	g.gen(st, opes[i], env)
+}
+
+func (g *SampleGenerator) repeat(st *sampleState, min int) int {
+	if g.short(st) || g.MaxRepeat <= min {
+		return min
+	}
+	return min + g.Rand.Intn(g.MaxRepeat-min+1)
+}
+
+// skipWhitespace inserts whitespace where the parser skips it.
+func (g *SampleGenerator) skipWhitespace(st *sampleState) {
+	if !st.inToken {
+		st.b.WriteString(g.sep)
+	}
+}
+
+func (g *SampleGenerator) gen(st *sampleState, ope Operator, env *macroEnv) {
+	if st.failed {
+		return
+	}
+
+	node := Inspect(ope)
+	switch node.Kind {
+	case SequenceNode:
+		for _, o := range node.Opes {
+			g.gen(st, o, env)
+		}
+	case ChoiceNode:
+		g.genChoice(st, node.Opes, nil, env)
+	case ZeroOrMoreNode, OneOrMoreNode:
+		min := 0
+		if node.Kind == OneOrMoreNode {
+			min = 1
+		}
+		for n := g.repeat(st, min); n > 0; n-- {
+			g.gen(st, node.Opes[0], env)
+		}
+	case OptionNode:
+		if !g.short(st) && g.Rand.Intn(2) == 0 {
+			g.gen(st, node.Opes[0], env)
+		}
+	case AndPredicateNode, NotPredicateNode:
+		// Checked by the parser
+	case LiteralNode:
+		st.b.WriteString(node.Lit)
+		g.skipWhitespace(st)
+	case ClassNode:
+		if c, ok := randomClassChar(g.Rand, node.Chars); ok {
+			st.b.WriteByte(c)
+		} else {
+			st.failed = true
+		}
+	case AnyCharacterNode:
+		st.b.WriteByte(byte(' ' + g.Rand.Intn('~'-' '+1)))
+	case TokenBoundaryNode:
+		inToken := st.inToken
+		st.inToken = true
+		g.gen(st, node.Opes[0], env)
+		st.inToken = inToken
+		g.skipWhitespace(st)
+	case IgnoreNode, WhitespaceNode:
+		g.gen(st, node.Opes[0], env)
+	case ExpressionNode:
+		g.gen(st, node.Opes[0], env)
+		for n := g.repeat(st, 0); n > 0; n-- {
+			g.gen(st, node.Opes[1], env)
+			g.gen(st, node.Opes[0], env)
+		}
+	case RuleNode:
+		g.genRule(st, node.rule, env)
+	case ReferenceNode:
+		if node.rule == nil {
+			// Macro parameter
+			ref, ok := ope.(*reference)
+			if !ok || env == nil || ref.iarg >= len(env.args) {
+				st.failed = true
+				return
+			}
+			g.gen(st, env.args[ref.iarg], env.outer)
+		} else if node.rule.Parameters != nil {
+			g.genRule(st, node.rule, &macroEnv{node.Args, env, 0})
+		} else {
+			g.genRule(st, node.rule, nil)
+		}
+	default:
+		// User defined operators can't be generated
+		st.failed = true
+	}
+}
+
+// cost returns the number of rules the shortest string of ope goes through.
+// Macro parameters are counted as 0.
+func (g *SampleGenerator) cost(ope Operator) int {
+	node := Inspect(ope)
+	switch node.Kind {
+	case SequenceNode:
+		cost := 0
+		for _, o := range node.Opes {
+			cost = maxInt(cost, g.cost(o))
+		}
+		return cost
+	case ChoiceNode:
+		cost := sampleInfinity
+		for _, o := range node.Opes {
+			if c := g.cost(o); c < cost {
+				cost = c
+			}
+		}
+		return cost
+	case OneOrMoreNode, TokenBoundaryNode, IgnoreNode, WhitespaceNode, ExpressionNode:
+		return g.cost(node.Opes[0])
+	case RuleNode:
+		return g.costs[node.rule]
+	case ReferenceNode:
+		if node.rule == nil {
+			return 0
+		}
+		cost := g.costs[node.rule]
+		for _, o := range node.Args {
+			cost = maxInt(cost, g.cost(o))
+		}
+		return cost
+	case UserNode:
+		return sampleInfinity
+	}
+	return 0
+}
+
+// randomClassChar returns a random character of a character class.
+func randomClassChar(rnd *rand.Rand, chars string) (byte, bool) {
+	type charRange struct{ lo, hi byte }
+	var ranges []charRange
+	total := 0
+	for i := 0; i < len(chars); {
+		if i+2 < len(chars) && chars[i+1] == '-' {
+			if chars[i] <= chars[i+2] {
+				ranges = append(ranges, charRange{chars[i], chars[i+2]})
+				total += int(chars[i+2]-chars[i]) + 1
+			}
+			i += 3
+		} else {
+			ranges = append(ranges, charRange{chars[i], chars[i]})
+			total++
+			i++
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	n := rnd.Intn(total)
+	for _, r := range ranges {
+		size := int(r.hi-r.lo) + 1
+		if n < size {
+			return r.lo + byte(n), true
+		}
+		n -= size
+	}
+	return 0, false
+}
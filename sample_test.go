@@ -0,0 +1,82 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSampleGenerator(t *testing.T) {
+	p, _ := NewParser(`
+        PROGRAM     <- STATEMENT+
+        STATEMENT   <- 'let' NAME '=' EXPR ';' / 'print' LIST(EXPR) ';'
+        LIST(X)     <- X (',' X)*
+        EXPR        <- TERM (< [-+] > TERM)*
+        TERM        <- NUMBER / NAME / '(' EXPR ')'
+        NAME        <- !KEYWORD < [a-z] [a-z0-9]* >
+        NUMBER      <- < [0-9]+ >
+        KEYWORD     <- ('let' / 'print') ![a-z0-9]
+        %whitespace <- [ \t\n]*
+        %word       <- [a-z0-9]+
+    `)
+
+	g := NewSampleGenerator(p, 1)
+	for i := 0; i < 100; i++ {
+		s, err := g.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Parse(s, nil); err != nil {
+			t.Errorf("sample %q doesn't parse: %v", s, err)
+		}
+		assert(t, !strings.HasSuffix(s, " "))
+	}
+
+	s, err := g.SampleRule("NUMBER")
+	assert(t, err == nil && s != "" && strings.Trim(s, "0123456789") == "")
+
+	_, err = g.SampleRule("LIST")
+	assert(t, err != nil)
+	_, err = g.SampleRule("UNDEFINED")
+	assert(t, err != nil)
+}
+
+func TestSampleGeneratorDepth(t *testing.T) {
+	p, _ := NewParser(`ROOT <- '(' ROOT ')' / 'x'`)
+
+	g := NewSampleGenerator(p, 1)
+	g.MaxDepth = 3
+	g.Weights = map[string][]float64{"ROOT": {1, 0}}
+	s, err := g.Sample()
+	assert(t, err == nil && s == "(((x)))")
+}
+
+func TestSampleGeneratorWeights(t *testing.T) {
+	p, _ := NewParser(`ROOT <- 'a' / 'b' / 'c'`)
+
+	g := NewSampleGenerator(p, 1)
+	g.Weights = map[string][]float64{"ROOT": {0, 1, 0}}
+	for i := 0; i < 10; i++ {
+		s, _ := g.Sample()
+		assert(t, s == "b")
+	}
+}
+
+func TestSampleGeneratorPredicate(t *testing.T) {
+	p, _ := NewParser(`ROOT <- !'ab' [ab] [ab]`)
+
+	g := NewSampleGenerator(p, 1)
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		s, err := g.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[s] = true
+	}
+	assert(t, len(seen) == 3 && !seen["ab"])
+
+	// No string is accepted
+	p, _ = NewParser(`ROOT <- !'a' 'a'`)
+	_, err := NewSampleGenerator(p, 1).Sample()
+	assert(t, err != nil)
+}
@@ -0,0 +1,245 @@
+package peg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	serializedFormat  = "go-peg"
+	serializedVersion = 1
+)
+
+// Serialized form of a grammar
+type serializedGrammar struct {
+	Format   string              `json:"format"`
+	Version  int                 `json:"version"`
+	Checksum string              `json:"checksum,omitempty"`
+	Start    string              `json:"start"`
+	Rules    []serializedRule    `json:"rules"`
+	Options  map[string][]string `json:"options,omitempty"`
+}
+
+type serializedRule struct {
+	Name   string         `json:"name"`
+	Pos    int            `json:"pos,omitempty"`
+	Ignore bool           `json:"ignore,omitempty"`
+	Macro  bool           `json:"macro,omitempty"`
+	Params []string       `json:"params,omitempty"`
+	Doc    string         `json:"doc,omitempty"`
+	Ope    *serializedOpe `json:"ope"`
+}
+
+type serializedOpe struct {
+	Kind string           `json:"k"`
+	Opes []*serializedOpe `json:"o,omitempty"`
+	Text string           `json:"t,omitempty"` // Literal, characters of a class or reference name
+	Args []*serializedOpe `json:"a,omitempty"`
+	Pos  int              `json:"p,omitempty"`
+}
+
+// GrammarChecksum returns the checksum of a grammar text, as returned by
+// Parser.Checksum.
+func GrammarChecksum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Checksum returns the checksum of the grammar text the parser was created
+// from, or an empty string if it was built without one. The checksum is kept
+// by SaveParser and LoadParser, so a saved parser can be checked against the
+// current grammar text with GrammarChecksum.
+func (p *Parser) Checksum() string {
+	return p.checksum
+}
+
+// SaveParser writes the linked grammar of a parser in JSON: the rules with
+// their operator trees, and the options. Actions and other handlers are not
+// saved. Grammars with user defined operators can't be saved.
+func SaveParser(w io.Writer, p *Parser) error {
+	g := &serializedGrammar{
+		Format:   serializedFormat,
+		Version:  serializedVersion,
+		Checksum: p.checksum,
+		Start:    p.start,
+		Options:  p.options,
+	}
+
+	for _, name := range p.RuleNames() {
+		r := p.Grammar[name]
+		ope, err := serializeOpe(r.Ope)
+		if err != nil {
+			return errors.New("'" + name + "' " + err.Error())
+		}
+		g.Rules = append(g.Rules, serializedRule{
+			Name:   name,
+			Pos:    r.Pos,
+			Ignore: r.Ignore,
+			Macro:  r.Parameters != nil,
+			Params: r.Parameters,
+			Doc:    r.Doc,
+			Ope:    ope,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(g)
+}
+
+// LoadParser reads a grammar written by SaveParser and returns its parser
+// without parsing PEG text.
+func LoadParser(r io.Reader) (*Parser, error) {
+	g := &serializedGrammar{}
+	if err := json.NewDecoder(r).Decode(g); err != nil {
+		return nil, err
+	}
+	if g.Format != serializedFormat {
+		return nil, errors.New("not a serialized grammar.")
+	}
+	if g.Version != serializedVersion {
+		return nil, fmt.Errorf("unsupported serialized grammar version %d.", g.Version)
+	}
+
+	data := newData()
+	data.start = g.Start
+	for name, vs := range g.Options {
+		data.options[name] = vs
+	}
+
+	for _, sr := range g.Rules {
+		ope, err := deserializeOpe(sr.Ope)
+		if err != nil {
+			return nil, errors.New("'" + sr.Name + "' " + err.Error())
+		}
+		r := &Rule{
+			Name:   sr.Name,
+			Pos:    sr.Pos,
+			Ope:    ope,
+			Ignore: sr.Ignore,
+			Doc:    sr.Doc,
+		}
+		if sr.Macro {
+			r.Parameters = append([]string{}, sr.Params...)
+		}
+		data.grammar[sr.Name] = r
+		data.names = append(data.names, sr.Name)
+	}
+
+	if _, ok := data.grammar[data.start]; !ok {
+		return nil, errors.New("start rule '" + data.start + "' is not defined.")
+	}
+
+	p, err := newParser("", data)
+	if err != nil {
+		return nil, err
+	}
+	p.checksum = g.Checksum
+	return p, nil
+}
+
+func serializeOpes(opes []Operator) ([]*serializedOpe, error) {
+	var sopes []*serializedOpe
+	for _, o := range opes {
+		so, err := serializeOpe(o)
+		if err != nil {
+			return nil, err
+		}
+		sopes = append(sopes, so)
+	}
+	return sopes, nil
+}
+
+func serializeOpe(ope Operator) (so *serializedOpe, err error) {
+	node := Inspect(ope)
+	so = &serializedOpe{Kind: node.Kind.String()}
+
+	switch node.Kind {
+	case LiteralNode:
+		so.Text = node.Lit
+	case ClassNode:
+		so.Text = node.Chars
+	case ReferenceNode:
+		so.Text = node.Name
+		so.Pos = node.Pos
+		if node.Args != nil {
+			so.Args, err = serializeOpes(node.Args)
+		}
+	case RuleNode:
+		so.Kind = ReferenceNode.String()
+		so.Text = node.Name
+	case WhitespaceNode:
+		return serializeOpe(node.Opes[0])
+	case ExpressionNode:
+		// Restored from the %expr option when loaded
+		atom, binop := node.Opes[0], node.Opes[1]
+		return serializeOpe(Seq(atom, Zom(Seq(binop, atom))))
+	case UserNode:
+		err = errors.New("contains a user defined operator.")
+	default:
+		so.Opes, err = serializeOpes(node.Opes)
+	}
+	return
+}
+
+func deserializeOpe(so *serializedOpe) (Operator, error) {
+	if so == nil {
+		return nil, errors.New("has no operator.")
+	}
+
+	var opes []Operator
+	for _, o := range so.Opes {
+		ope, err := deserializeOpe(o)
+		if err != nil {
+			return nil, err
+		}
+		opes = append(opes, ope)
+	}
+
+	unary := func(fn func(Operator) Operator) (Operator, error) {
+		if len(opes) != 1 {
+			return nil, errors.New("has a malformed " + so.Kind + " operator.")
+		}
+		return fn(opes[0]), nil
+	}
+
+	switch so.Kind {
+	case SequenceNode.String():
+		return SeqCore(opes), nil
+	case ChoiceNode.String():
+		return ChoCore(opes), nil
+	case ZeroOrMoreNode.String():
+		return unary(Zom)
+	case OneOrMoreNode.String():
+		return unary(Oom)
+	case OptionNode.String():
+		return unary(Opt)
+	case AndPredicateNode.String():
+		return unary(Apd)
+	case NotPredicateNode.String():
+		return unary(Npd)
+	case TokenBoundaryNode.String():
+		return unary(Tok)
+	case IgnoreNode.String():
+		return unary(Ign)
+	case LiteralNode.String():
+		return Lit(so.Text), nil
+	case ClassNode.String():
+		return Cls(so.Text), nil
+	case AnyCharacterNode.String():
+		return Dot(), nil
+	case ReferenceNode.String():
+		var args []Operator
+		for _, a := range so.Args {
+			arg, err := deserializeOpe(a)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return Ref(so.Text, args, so.Pos), nil
+	}
+	return nil, errors.New("has an unknown operator '" + so.Kind + "'.")
+}
@@ -0,0 +1,124 @@
+package peg
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadParser(t *testing.T) {
+	count := 0
+	for _, grammar := range testGrammars(t) {
+		p1, err := NewParser(grammar.text)
+		if err != nil {
+			continue
+		}
+
+		var saved bytes.Buffer
+		if err := SaveParser(&saved, p1); err != nil {
+			continue
+		}
+		count++
+
+		p2, err := LoadParser(&saved)
+		if err != nil {
+			t.Errorf("can't load saved grammar:\n%s\n%v", grammar.text, err)
+			continue
+		}
+
+		var b1, b2 bytes.Buffer
+		PrintGrammar(&b1, p1)
+		PrintGrammar(&b2, p2)
+		if b1.String() != b2.String() {
+			t.Errorf("load mismatch:\n%s\n---\n%s", b1.String(), b2.String())
+		}
+		assert(t, p2.Checksum() == GrammarChecksum(grammar.text))
+		for name, r := range p1.Grammar {
+			assert(t, p2.Grammar[name].Doc == r.Doc)
+		}
+	}
+	assert(t, count > 30)
+}
+
+func TestLoadParserParse(t *testing.T) {
+	grammar := `
+        EXPRESSION       <-  ATOM (BINOP ATOM)*
+        ATOM             <-  NUMBER / '(' EXPRESSION ')'
+        BINOP            <-  < [-+/*] >
+        NUMBER           <-  < [0-9]+ >
+        %whitespace      <-  [ \t]*
+        ---
+        # Expression parsing
+        %expr  = EXPRESSION
+        %binop = L + -
+        %binop = L * /
+    `
+	p1, _ := NewParser(grammar)
+
+	var saved bytes.Buffer
+	if err := SaveParser(&saved, p1); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadParser(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := p.Grammar
+	g["EXPRESSION"].Action = func(v *Values, d Any) (Any, error) {
+		val := v.ToInt(0)
+		if v.Len() > 1 {
+			rhs := v.ToInt(2)
+			switch v.ToStr(1) {
+			case "+":
+				val += rhs
+			case "-":
+				val -= rhs
+			case "*":
+				val *= rhs
+			case "/":
+				val /= rhs
+			}
+		}
+		return val, nil
+	}
+	g["BINOP"].Action = func(v *Values, d Any) (Any, error) {
+		return v.Token(), nil
+	}
+	g["NUMBER"].Action = func(v *Values, d Any) (Any, error) {
+		return strconv.Atoi(v.Token())
+	}
+
+	val, err := p.ParseAndGetValue(" (1 + 2 * (3 + 4)) / 5 - 6 ", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, val == -3)
+}
+
+func TestLoadParserErrors(t *testing.T) {
+	for _, src := range []string{
+		`not json`,
+		`{"format": "other", "version": 1, "start": "A"}`,
+		`{"format": "go-peg", "version": 99, "start": "A"}`,
+		`{"format": "go-peg", "version": 1, "start": "B", "rules": [{"name": "A", "ope": {"k": "Literal", "t": "a"}}]}`,
+		`{"format": "go-peg", "version": 1, "start": "A", "rules": [{"name": "A", "ope": {"k": "Bogus"}}]}`,
+		`{"format": "go-peg", "version": 1, "start": "A", "rules": [{"name": "A", "ope": {"k": "Reference", "t": "B"}}]}`,
+	} {
+		if _, err := LoadParser(strings.NewReader(src)); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+func TestSaveParserUserRule(t *testing.T) {
+	p, _ := NewParserWithUserRules("ROOT <- _ USER", map[string]Operator{
+		"_":    Zom(Cls(" ")),
+		"USER": Usr(func(s string, p int, v *Values, d Any) int { return 0 }),
+	})
+
+	var saved bytes.Buffer
+	err := SaveParser(&saved, p)
+	assert(t, err != nil)
+}
@@ -0,0 +1,221 @@
+package peg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+const defaultStreamChunkSize = 64 * 1024
+
+// StreamParser parses a sequence of top-level items from an io.Reader.
+//
+// Input is kept in a sliding buffer. An item is only accepted once its parse
+// did not need to look at the end of the buffered data, so no backtracking
+// point can reach the input in front of it anymore; that input is released
+// before the next item is parsed. Positions in Values and Ast nodes are
+// relative to the start of the buffered input of the current item, while
+// errors report absolute line and column numbers. A user defined operator is
+// assumed to look at the end of the buffered data only when its match reaches
+// it or when it fails at it, so it must not fail in front of it because the
+// data ends too early.
+type StreamParser struct {
+	ChunkSize int // Number of bytes read from the reader at a time
+
+	rule          *Rule
+	whitespaceOpe Operator
+	wordOpe       Operator
+	tracerEnter   func(name string, s string, v *Values, d Any, p int)
+	tracerLeave   func(name string, s string, v *Values, d Any, p int, l int)
+	observer      Observer
+	traceFlush    func()
+	packrat       bool
+
+	r   io.Reader
+	buf []byte
+	eof bool
+
+	ln   int    // Line number of buf[0]
+	col  int    // Column number of buf[0]
+	head []byte // Released input on the line of buf[0]
+}
+
+// NewStreamParser returns a StreamParser reading items of the given rule from
+// r. If item is empty, the start rule is used. The %whitespace and %word
+// definitions of the grammar apply to the items.
+func (p *Parser) NewStreamParser(r io.Reader, item string) (*StreamParser, error) {
+	if item == "" {
+		item = p.start
+	}
+	rule, ok := p.Grammar[item]
+	if !ok {
+		return nil, errors.New("'" + item + "' is not defined.")
+	}
+	start := p.Grammar[p.start]
+	return &StreamParser{
+		ChunkSize:     defaultStreamChunkSize,
+		rule:          rule,
+		whitespaceOpe: start.WhitespaceOpe,
+		wordOpe:       start.WordOpe,
+		tracerEnter:   p.TracerEnter,
+		tracerLeave:   p.TracerLeave,
+		observer:      p.Observer,
+		traceFlush:    p.traceFlush,
+		packrat:       p.PackratEnabled,
+		r:             r,
+		ln:            1,
+		col:           1,
+	}, nil
+}
+
+// Next parses the next item and returns its semantic value. It returns io.EOF
+// when only whitespace is left in the input.
+func (sp *StreamParser) Next(d Any) (val Any, err error) {
+	if sp.traceFlush != nil {
+		defer sp.traceFlush()
+	}
+	for {
+		if len(sp.buf) == 0 && !sp.eof {
+			if err = sp.fill(); err != nil {
+				return
+			}
+			continue
+		}
+
+		// The bytes of the buffer are never changed: fill copies them to a
+		// new array and consume only reslices it.
+		s := bytesToString(sp.buf)
+
+		// Trailing whitespace
+		if sp.whitespaceOpe != nil {
+			c := sp.newContext(s)
+			l := sp.whitespaceOpe.parse(s, 0, &Values{}, c, d)
+			if l == len(s) {
+				if !sp.eof {
+					if err = sp.fill(); err != nil {
+						return
+					}
+					continue
+				}
+				sp.consume(l)
+			}
+		}
+		if len(sp.buf) == 0 && sp.eof {
+			return nil, io.EOF
+		}
+
+		c := sp.newContext(s)
+		l, v := sp.rule.parseInContext(s, d, c)
+		if c.hitEnd && !sp.eof {
+			// The item might continue in the input not read yet
+			if err = sp.fill(); err != nil {
+				return
+			}
+			continue
+		}
+
+		if fail(l) {
+			err = sp.relocate(c.newError(s, l, sp.rule))
+			return
+		}
+
+		sp.consume(l)
+		return v, nil
+	}
+}
+
+// ParseReader parses all items of the given rule in r and calls fn with the
+// semantic value of each item as soon as it is parsed.
+func (p *Parser) ParseReader(r io.Reader, item string, d Any, fn func(val Any) error) error {
+	sp, err := p.NewStreamParser(r, item)
+	if err != nil {
+		return err
+	}
+	for {
+		val, err := sp.Next(d)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(val); err != nil {
+			return err
+		}
+	}
+}
+
+func (sp *StreamParser) newContext(s string) *context {
+	return &context{
+		s:             s,
+		errorPos:      -1,
+		messagePos:    -1,
+		outerErrorPos: -1,
+		whitespaceOpe: sp.whitespaceOpe,
+		wordOpe:       sp.wordOpe,
+		tracerEnter:   sp.tracerEnter,
+		tracerLeave:   sp.tracerLeave,
+		observer:      sp.observer,
+		memo:          newMemo(sp.packrat),
+	}
+}
+
+// fill reads the next chunk from the reader, growing the buffer.
+func (sp *StreamParser) fill() error {
+	size := sp.ChunkSize
+	if size <= 0 {
+		size = defaultStreamChunkSize
+	}
+	if size < len(sp.buf) {
+		// Keep reparsing long items in amortized linear time
+		size = len(sp.buf)
+	}
+
+	buf := make([]byte, len(sp.buf), len(sp.buf)+size)
+	copy(buf, sp.buf)
+
+	n, err := io.ReadFull(sp.r, buf[len(buf):cap(buf)])
+	sp.buf = buf[:len(buf)+n]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		sp.eof = true
+		return nil
+	}
+	return err
+}
+
+// consume releases the first l bytes of the buffer.
+func (sp *StreamParser) consume(l int) {
+	consumed := sp.buf[:l]
+	if n := bytes.Count(consumed, []byte{'\n'}); n > 0 {
+		sp.ln += n
+		sp.col = 1
+		sp.head = sp.head[:0]
+		consumed = consumed[bytes.LastIndexByte(consumed, '\n')+1:]
+	}
+	sp.col += len(consumed)
+	sp.head = append(sp.head, consumed...)
+	sp.buf = sp.buf[l:]
+}
+
+// relocate turns line and column numbers relative to the buffer into absolute
+// ones.
+func (sp *StreamParser) relocate(err error) error {
+	var details []ErrorDetail
+	switch e := err.(type) {
+	case *Error:
+		details = e.Details
+	case *SyntaxError:
+		details = e.BaseError.Details
+		e.ln, e.col = sp.ln, sp.col
+	}
+	for i := range details {
+		if details[i].Ln == 1 {
+			details[i].Col += sp.col - 1
+			if len(details[i].Line) > 0 {
+				details[i].Line = string(sp.head) + details[i].Line
+			}
+		}
+		details[i].Ln += sp.ln - 1
+	}
+	return err
+}
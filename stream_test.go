@@ -0,0 +1,100 @@
+package peg
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamParser(t *testing.T) {
+	parser, _ := NewParser(`
+		ITEMS   <- ITEM*
+		ITEM    <- NAME '=' NUMBER ';'
+		NAME    <- < [a-z]+ >
+		NUMBER  <- < [0-9]+ >
+		%whitespace <- [ \t\r\n]*
+	`)
+
+	parser.Grammar["NUMBER"].Action = func(v *Values, d Any) (Any, error) {
+		return strconv.Atoi(v.Token())
+	}
+	parser.Grammar["ITEM"].Action = func(v *Values, d Any) (Any, error) {
+		return v.ToInt(1), nil
+	}
+
+	input := " a = 1;\n bbb = 22;\n\tcc=333 ; \n"
+
+	sp, err := parser.NewStreamParser(iotest.OneByteReader(strings.NewReader(input)), "ITEM")
+	assert(t, err == nil)
+	sp.ChunkSize = 2
+
+	var vals []int
+	for {
+		val, err := sp.Next(nil)
+		if err != nil {
+			break
+		}
+		vals = append(vals, val.(int))
+	}
+	assert(t, len(vals) == 3)
+	assert(t, vals[0] == 1 && vals[1] == 22 && vals[2] == 333)
+	assert(t, len(sp.buf) == 0)
+}
+
+func TestStreamParserError(t *testing.T) {
+	parser, _ := NewParser(`
+		ITEM    <- NAME '=' NAME ';'
+		NAME    <- < [a-z]+ >
+		%whitespace <- [ \t\r\n]*
+	`)
+
+	count := 0
+	err := parser.ParseReader(strings.NewReader("a = b;\nc = d;\n  e = ;\n"), "", nil, func(val Any) error {
+		count++
+		return nil
+	})
+	assert(t, count == 2)
+	assert(t, err != nil)
+
+	pegErr, ok := err.(*SyntaxError)
+	assert(t, ok)
+	assert(t, pegErr.BaseError.Details[0].Ln == 3)
+	assert(t, pegErr.BaseError.Details[0].Col == 7)
+	assert(t, pegErr.BaseError.Details[0].Line == "  e = ;")
+}
+
+func TestStreamParserUserOperator(t *testing.T) {
+	parser, _ := NewParserWithUserRules(`
+		ITEM <- ';' NUMBER
+	`, map[string]Operator{
+		"NUMBER": Usr(func(s string, p int, v *Values, d Any) int {
+			l := 0
+			for p+l < len(s) && '0' <= s[p+l] && s[p+l] <= '9' {
+				l++
+			}
+			if l == 0 {
+				return -1
+			}
+			v.Vs = append(v.Vs, s[p:p+l])
+			return l
+		}),
+	})
+	parser.Grammar["ITEM"].Action = func(v *Values, d Any) (Any, error) {
+		return v.ToStr(0), nil
+	}
+
+	sp, err := parser.NewStreamParser(strings.NewReader(";12;345"), "")
+	assert(t, err == nil)
+	sp.ChunkSize = 2
+
+	var vals []string
+	for {
+		val, err := sp.Next(nil)
+		if err != nil {
+			break
+		}
+		vals = append(vals, val.(string))
+	}
+	assert(t, len(vals) == 2 && vals[0] == "12" && vals[1] == "345")
+}
@@ -0,0 +1,366 @@
+package peg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// Maximum number of names returned by similarNames
+const maxSimilarNames = 3
+
+// similarNames returns the candidates close to name by edit distance,
+// ignoring case, closest first.
+func similarNames(name string, candidates []string) []string {
+	maxDist := len([]rune(name)) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	} else if maxDist > 3 {
+		maxDist = 3
+	}
+
+	dist := make(map[string]int)
+	var similar []string
+	for _, c := range candidates {
+		if _, ok := dist[c]; ok || c == name {
+			continue
+		}
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d <= maxDist {
+			dist[c] = d
+			similar = append(similar, c)
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if di, dj := dist[similar[i]], dist[similar[j]]; di != dj {
+			return di < dj
+		}
+		return similar[i] < similar[j]
+	})
+	if len(similar) > maxSimilarNames {
+		similar = similar[:maxSimilarNames]
+	}
+	return similar
+}
+
+// quoteNames returns names as "'a', 'b' or 'c'".
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// trialAbort is the panic ending a trial parse after a panic in a hook of the
+// user, which may not expect a trial parse.
+type trialAbort struct {
+	value interface{}
+}
+
+// abortTrial turns a panic in a hook of the user during a trial parse into a
+// trialAbort. It must be deferred around the call of the hook.
+func abortTrial() {
+	if r := recover(); r != nil {
+		panic(trialAbort{r})
+	}
+}
+
+// trialParse parses s with rule r without invoking actions and hooks, and
+// returns how far it gets: the farthest error position, or len(s)+1 if all of
+// s matches. It returns -1 if a user defined operator or a Message hook panics.
+func trialParse(r *Rule, ws, word Operator, s string) (pos int) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(trialAbort); !ok {
+				panic(r)
+			}
+			pos = -1
+		}
+	}()
+
+	c := &context{
+		s:             s,
+		errorPos:      -1,
+		messagePos:    -1,
+		whitespaceOpe: ws,
+		wordOpe:       word,
+		noActions:     true,
+	}
+
+	var ope Operator = r
+	if ws != nil {
+		ope = Seq(ws, r)
+	}
+
+	l := ope.parse(s, 0, &Values{}, c, nil)
+	if success(l) && l == len(s) {
+		return len(s) + 1
+	}
+	if l > c.errorPos {
+		return l
+	}
+	return c.errorPos
+}
+
+// Maximum number of repairs suggested, of repairs tried, and length of the
+// input for which repairs are tried
+const (
+	maxRepairs      = 3
+	maxRepairTrials = 8
+	maxRepairInput  = 64 << 10
+)
+
+const (
+	separatorLiterals = ",;"
+	openingDelimiters = "([{"
+	closingDelimiters = ")]}"
+)
+
+// position returns the line and column of an offset in the input.
+func (e *SyntaxError) position(pos int) (ln, col int) {
+	ln, col = lineInfo(e.input, pos)
+	if ln == 1 {
+		col += e.col - 1
+	}
+	ln += e.ln - 1
+	return
+}
+
+// expectedLiterals returns the literals among the expected tokens.
+func (e *SyntaxError) expectedLiterals() []string {
+	var lits []string
+	for _, t := range e.Expected {
+		if len(t) > 2 && t[0] == '\'' && t[len(t)-1] == '\'' {
+			lits = append(lits, t[1:len(t)-1])
+		}
+	}
+	return lits
+}
+
+// found returns the word at the error position, or the character there if
+// it doesn't start a word.
+func (e *SyntaxError) found() string {
+	rest := e.input[e.pos:]
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if end == -1 {
+		end = len(rest)
+	}
+	if end == 0 {
+		_, end = utf8.DecodeRuneInString(rest)
+	}
+	return rest[:end]
+}
+
+// where describes the error position for repairs.
+func (e *SyntaxError) where() string {
+	if e.pos >= len(e.input) {
+		return "at the end of the input"
+	}
+	return "before '" + e.found() + "'"
+}
+
+func (e *SyntaxError) inputSuggestions() []string {
+	if e.trial == nil || e.pos < 0 || e.pos > len(e.input) {
+		return nil
+	}
+
+	var suggestions []string
+	lits := e.expectedLiterals()
+	found := e.found()
+	rest := e.input[e.pos:]
+
+	// Literals written in another case, or with a typo
+	for _, lit := range lits {
+		if len(rest) >= len(lit) && rest[:len(lit)] != lit && strings.EqualFold(rest[:len(lit)], lit) {
+			suggestions = append(suggestions, fmt.Sprintf("Found '%s', but literals are case sensitive: did you mean '%s'?", rest[:len(lit)], lit))
+		}
+	}
+	if found != "" {
+		var words []string
+		for _, lit := range lits {
+			if !strings.EqualFold(found, lit) && len(lit) > 1 {
+				words = append(words, lit)
+			}
+		}
+		if similar := similarNames(found, words); len(similar) > 0 {
+			suggestions = append(suggestions, fmt.Sprintf("Found '%s': did you mean %s?", found, quoteNames(similar)))
+		}
+	}
+
+	// Delimiters opened but not closed
+	if open, pos := unclosedDelimiter(e.input[:e.pos]); open != 0 {
+		closing := string(closingDelimiters[strings.IndexByte(openingDelimiters, open)])
+		for _, lit := range lits {
+			if lit == closing {
+				ln, col := e.position(pos)
+				suggestions = append(suggestions, fmt.Sprintf("The '%c' at line %d, column %d is not closed: insert '%s' %s", open, ln, col, closing, e.where()))
+				break
+			}
+		}
+	}
+
+	return append(suggestions, e.repairs(lits, found)...)
+}
+
+// unclosedDelimiter returns the innermost bracket left open in s and its
+// position, skipping quoted strings.
+func unclosedDelimiter(s string) (open byte, pos int) {
+	var stack []int
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != ch && s[j] != '\n' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(s) && s[j] == ch {
+				i = j
+			}
+		case strings.IndexByte(openingDelimiters, ch) != -1:
+			stack = append(stack, i)
+		case strings.IndexByte(closingDelimiters, ch) != -1:
+			n := len(stack)
+			if n > 0 && openingDelimiters[strings.IndexByte(closingDelimiters, ch)] == s[stack[n-1]] {
+				stack = stack[:n-1]
+			}
+		}
+	}
+	if len(stack) == 0 {
+		return 0, -1
+	}
+	pos = stack[len(stack)-1]
+	return s[pos], pos
+}
+
+type repair struct {
+	msg      string
+	progress int // Position the trial parse gets to in the original input
+	complete bool
+}
+
+// repairs tries inserting an expected literal and deleting the text at the
+// error position, and returns the repairs that let parsing get further,
+// best first. Each try parses the whole input, so their number is bounded,
+// and long inputs are not tried.
+func (e *SyntaxError) repairs(lits []string, found string) []string {
+	if len(e.input) > maxRepairInput {
+		return nil
+	}
+
+	var repairs []repair
+	complete, trials := 0, 0
+	try := func(msg string, s string, shift func(pos int) int) {
+		if complete == maxRepairs || trials == maxRepairTrials {
+			return
+		}
+		trials++
+		pos := e.trial(s)
+		if pos == len(s)+1 {
+			repairs = append(repairs, repair{msg, len(e.input), true})
+			complete++
+		} else if pos = shift(pos); pos > e.pos {
+			if pos > len(e.input) {
+				pos = len(e.input)
+			}
+			repairs = append(repairs, repair{msg, pos, false})
+		}
+	}
+
+	if found != "" {
+		_, n := utf8.DecodeRuneInString(found)
+		dels := []string{found[:n]}
+		if n < len(found) {
+			dels = append(dels, found)
+		}
+		for _, del := range dels {
+			try(fmt.Sprintf("Delete '%s'", del), e.input[:e.pos]+e.input[e.pos+len(del):], func(pos int) int {
+				// Failing where the text was deleted is no progress
+				if pos > e.pos {
+					return pos + len(del)
+				}
+				return pos
+			})
+		}
+	}
+
+	for _, lit := range lits {
+		msg := fmt.Sprintf("Insert '%s' %s", lit, e.where())
+		if len(lit) == 1 && strings.Contains(separatorLiterals, lit) {
+			msg = fmt.Sprintf("Missing separator: insert '%s' %s", lit, e.where())
+		}
+		try(msg, e.input[:e.pos]+lit+e.input[e.pos:], func(pos int) int {
+			if pos >= e.pos+len(lit) {
+				return pos - len(lit)
+			}
+			return pos
+		})
+	}
+
+	sort.SliceStable(repairs, func(i, j int) bool {
+		if repairs[i].complete != repairs[j].complete {
+			return repairs[i].complete
+		}
+		return repairs[i].progress > repairs[j].progress
+	})
+	if len(repairs) > maxRepairs {
+		repairs = repairs[:maxRepairs]
+	}
+
+	var msgs []string
+	for _, r := range repairs {
+		switch {
+		case r.complete:
+			msgs = append(msgs, r.msg+"; the input then parses")
+		case r.progress == len(e.input):
+			msgs = append(msgs, r.msg+"; parsing then gets to the end of the input")
+		default:
+			ln, col := e.position(r.progress)
+			msgs = append(msgs, fmt.Sprintf("%s; parsing then gets to line %d, column %d", r.msg, ln, col))
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,149 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	assert(t, editDistance("", "") == 0)
+	assert(t, editDistance("abc", "") == 3)
+	assert(t, editDistance("Expresion", "Expression") == 1)
+	assert(t, editDistance("retrun", "return") == 2)
+	assert(t, editDistance("kitten", "sitting") == 3)
+}
+
+func TestSimilarNames(t *testing.T) {
+	names := similarNames("Expresion", []string{"Expression", "Term", "Expressions", "ExpresionList"})
+	assert(t, len(names) == 2)
+	assert(t, names[0] == "Expression")
+	assert(t, names[1] == "Expressions")
+
+	assert(t, len(similarNames("a", []string{"bcd"})) == 0)
+	assert(t, quoteNames([]string{"a"}) == "'a'")
+	assert(t, quoteNames([]string{"a", "b", "c"}) == "'a', 'b' or 'c'")
+}
+
+func syntaxSuggestions(t *testing.T, p *Parser, s string) []string {
+	err := p.Parse(s, nil)
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected a syntax error for %q: %v", s, err)
+	}
+	return se.GetSuggestions()
+}
+
+func hasSuggestion(suggestions []string, s string) bool {
+	for _, sug := range suggestions {
+		if sug == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSyntaxErrorSuggestions(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT        <- STMT+
+        STMT        <- 'return' EXPR ';' / 'print' '(' LIST ')' ';'
+        LIST        <- EXPR (',' EXPR)*
+        EXPR        <- NUMBER / '(' EXPR ')' / 'SELECT'
+        NUMBER      <- < [0-9]+ >
+        %whitespace <- [ \t\n]*
+    `)
+
+	calls := 0
+	p.Grammar["NUMBER"].Action = func(v *Values, d Any) (Any, error) {
+		calls++
+		return v.Token(), nil
+	}
+
+	sugs := syntaxSuggestions(t, p, "retrun 1;")
+	assert(t, hasSuggestion(sugs, "Found 'retrun': did you mean 'return'?"))
+
+	sugs = syntaxSuggestions(t, p, "return select;")
+	assert(t, hasSuggestion(sugs, "Found 'select', but literals are case sensitive: did you mean 'SELECT'?"))
+
+	sugs = syntaxSuggestions(t, p, "print(1, 2;")
+	assert(t, hasSuggestion(sugs, "The '(' at line 1, column 6 is not closed: insert ')' before ';'"))
+	assert(t, hasSuggestion(sugs, "Insert ')' before ';'; the input then parses"))
+
+	sugs = syntaxSuggestions(t, p, "print(1\n2);")
+	assert(t, hasSuggestion(sugs, "Missing separator: insert ',' before '2'; the input then parses"))
+
+	sugs = syntaxSuggestions(t, p, "return (\n  (1")
+	assert(t, hasSuggestion(sugs, "The '(' at line 2, column 3 is not closed: insert ')' at the end of the input"))
+
+	// Trial parses don't invoke actions
+	err := p.Parse("print(1 2 3);", nil)
+	calls = 0
+	err.(*SyntaxError).GetSuggestions()
+	assert(t, calls == 0)
+
+	sugs = syntaxSuggestions(t, p, "%")
+	assert(t, sugs[0] == "Expected one of: [ \t\n], 'return', 'print'")
+}
+
+func TestSyntaxErrorSuggestionsExpression(t *testing.T) {
+	p, _ := NewParser(`
+        EXPRESSION  <- ATOM (BINOP ATOM)*
+        ATOM        <- NUMBER / '(' EXPRESSION ')'
+        BINOP       <- < [-+/*] >
+        NUMBER      <- < [0-9]+ >
+        %whitespace <- [ \t]*
+        ---
+        %expr  = EXPRESSION
+        %binop = L + -
+        %binop = L * /
+    `)
+
+	calls := 0
+	count := func(v *Values, d Any) (Any, error) {
+		calls++
+		return v.Token(), nil
+	}
+	p.Grammar["BINOP"].Action = count
+	p.Grammar["NUMBER"].Action = count
+
+	err := p.Parse("(1 + 2 * 3", nil)
+	calls = 0
+	sugs := err.(*SyntaxError).GetSuggestions()
+	assert(t, hasSuggestion(sugs, "Insert ')' at the end of the input; the input then parses"))
+	assert(t, calls == 0)
+}
+
+func TestSyntaxErrorRepairProgress(t *testing.T) {
+	p, _ := NewParser(`ROOT <- 'abcd' 'e'`)
+
+	// Deleting the last character gets nowhere
+	sugs := syntaxSuggestions(t, p, "abcd ")
+	for _, sug := range sugs {
+		assert(t, !strings.HasPrefix(sug, "Delete"))
+	}
+
+	// Progress is reported within the input
+	p, _ = NewParser(`ROOT <- 'a' 'b' 'c' 'd'`)
+	sugs = syntaxSuggestions(t, p, "a b c")
+	assert(t, hasSuggestion(sugs, "Delete ' '; parsing then gets to line 1, column 4"))
+	sugs = syntaxSuggestions(t, p, "axbc")
+	assert(t, hasSuggestion(sugs, "Delete 'x'; parsing then gets to the end of the input"))
+}
+
+func TestTrialParsePanic(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- 'a' USER 'c'
+        USER <- 'b'
+    `)
+	p.Grammar["USER"].Ope = Usr(func(s string, p int, v *Values, d Any) int {
+		panic("user")
+	})
+	r := p.Grammar["ROOT"]
+	assert(t, trialParse(r, nil, nil, "abc") == -1)
+
+	// Panics that don't come from the user are not hidden
+	r.Ope.(*sequence).opes[1] = nil
+	defer func() {
+		assert(t, recover() != nil)
+	}()
+	trialParse(r, nil, nil, "abc")
+}
@@ -0,0 +1,176 @@
+package peg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of trace events
+type TraceEventKind int
+
+const (
+	TraceEnter TraceEventKind = iota // An operator is tried
+	TraceLeave                       // An operator matched or failed
+	TraceToken                       // A token was captured
+	TraceError                       // The parse failed
+)
+
+var traceEventKindNames = []string{"enter", "leave", "token", "error"}
+
+func (k TraceEventKind) String() string {
+	if k >= 0 && int(k) < len(traceEventKindNames) {
+		return traceEventKindNames[k]
+	}
+	return fmt.Sprintf("TraceEventKind(%d)", int(k))
+}
+
+// TraceEvent is an event of a trace enabled with EnableTracing.
+type TraceEvent struct {
+	Kind      TraceEventKind
+	Name      string // Label of the operator, like "[EXPR]" or "sequence"
+	Rule      string // Name of the rule if the operator is a rule
+	Pos       int
+	Depth     int
+	Len       int  // Length of the match, or -1 on failure (TraceLeave)
+	Backtrack bool // The parser went back before the previous operator tried (TraceEnter)
+	Token     string
+
+	Message     string // Error message (TraceError)
+	Suggestions []string
+}
+
+// TraceSink receives the events of a trace.
+type TraceSink interface {
+	Trace(ev *TraceEvent)
+}
+
+// TextTraceSink writes events as indented text lines starting with the
+// position and the depth.
+type TextTraceSink struct {
+	w *errWriter
+}
+
+// NewTextTraceSink returns a sink writing events to w.
+func NewTextTraceSink(w io.Writer) *TextTraceSink {
+	return &TextTraceSink{&errWriter{w: w}}
+}
+
+// Err returns the first error writing the events. The events after it are
+// dropped.
+func (t *TextTraceSink) Err() error {
+	return t.w.err
+}
+
+func (t *TextTraceSink) Trace(ev *TraceEvent) {
+	if t.w.err != nil {
+		return
+	}
+	indent := strings.Repeat("  ", ev.Depth)
+	switch ev.Kind {
+	case TraceEnter:
+		var backtrack string
+		if ev.Backtrack {
+			backtrack = "*"
+		}
+		fmt.Fprintf(t.w, "%d:%d%s\t%s%s\n", ev.Pos, ev.Depth, backtrack, indent, ev.Name)
+	case TraceLeave:
+		if ev.Len >= 0 {
+			fmt.Fprintf(t.w, "%d:%d\t%s%s (SUCCESS, len=%d)\n", ev.Pos, ev.Depth, indent, ev.Name, ev.Len)
+		} else {
+			fmt.Fprintf(t.w, "%d:%d\t%s%s (FAILED)\n", ev.Pos, ev.Depth, indent, ev.Name)
+		}
+	case TraceToken:
+		fmt.Fprintf(t.w, "%d:%d\t%s%q (TOKEN)\n", ev.Pos, ev.Depth, indent, ev.Token)
+	case TraceError:
+		fmt.Fprintln(t.w, "\nError Context:")
+		fmt.Fprintln(t.w, ev.Message)
+		if len(ev.Suggestions) > 0 {
+			fmt.Fprintln(t.w, "\nSuggestions:")
+			for _, suggestion := range ev.Suggestions {
+				fmt.Fprintln(t.w, "- "+suggestion)
+			}
+		}
+	}
+}
+
+// JSONTraceSink writes events as JSON objects, one per line.
+type JSONTraceSink struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONTraceSink returns a sink writing events to w.
+func NewJSONTraceSink(w io.Writer) *JSONTraceSink {
+	return &JSONTraceSink{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing the events. The events after it are
+// dropped.
+func (t *JSONTraceSink) Err() error {
+	return t.err
+}
+
+type jsonTraceEvent struct {
+	Event       string   `json:"event"`
+	Name        string   `json:"name,omitempty"`
+	Rule        string   `json:"rule,omitempty"`
+	Pos         *int     `json:"pos,omitempty"`
+	Depth       *int     `json:"depth,omitempty"`
+	Len         *int     `json:"len,omitempty"`
+	Success     *bool    `json:"success,omitempty"`
+	Backtrack   bool     `json:"backtrack,omitempty"`
+	Token       *string  `json:"token,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func (t *JSONTraceSink) Trace(ev *TraceEvent) {
+	if t.err != nil {
+		return
+	}
+	je := jsonTraceEvent{
+		Event:       ev.Kind.String(),
+		Name:        ev.Name,
+		Rule:        ev.Rule,
+		Backtrack:   ev.Backtrack,
+		Message:     ev.Message,
+		Suggestions: ev.Suggestions,
+	}
+	if ev.Kind != TraceError {
+		je.Pos = &ev.Pos
+		je.Depth = &ev.Depth
+	}
+	switch ev.Kind {
+	case TraceLeave:
+		success := ev.Len >= 0
+		je.Len = &ev.Len
+		je.Success = &success
+	case TraceToken:
+		je.Token = &ev.Token
+	}
+	t.err = t.enc.Encode(&je)
+}
+
+// errWriter keeps the first error of the writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(b []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, w.err = w.w.Write(b)
+	return n, w.err
+}
+
+// traceRuleName returns the name of the rule of an operator label, or "".
+func traceRuleName(label string) string {
+	if strings.HasPrefix(label, "[") && strings.HasSuffix(label, "]") {
+		return label[1 : len(label)-1]
+	}
+	return ""
+}
@@ -0,0 +1,316 @@
+package peg
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"unicode/utf8"
+)
+
+// TraceRecorder records the rules tried in a parse, to be written as an HTML
+// page with WriteHTML. It is an Observer: set it as Parser.Observer. Only
+// the last parse is kept.
+type TraceRecorder struct {
+	Input string
+	Calls []*RuleCall // Calls of the rules tried at the top level
+
+	count     int
+	prevPos   int
+	backtrack bool // The parser went back since the previous call
+	stack     []*RuleCall
+}
+
+// RuleCall is a rule tried at a position of the input.
+type RuleCall struct {
+	Rule      string
+	Pos       int
+	Len       int  // Length of the match, or -1 on failure
+	Seq       int  // Index of the call in the order the rules were tried
+	Backtrack bool // The parser went back in the input since the previous call
+	Calls     []*RuleCall
+}
+
+// NewTraceRecorder returns a trace recorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+func (tr *TraceRecorder) Enter(ev *ParseEvent) {
+	if ev.Depth == 0 {
+		// A new parse
+		tr.Input = ev.S
+		tr.Calls = nil
+		tr.count = 0
+		tr.prevPos = 0
+		tr.backtrack = false
+		tr.stack = tr.stack[:0]
+	}
+	if ev.Pos < tr.prevPos {
+		tr.backtrack = true
+	}
+	tr.prevPos = ev.Pos
+	if ev.Rule == nil {
+		return
+	}
+
+	call := &RuleCall{
+		Rule:      ev.Rule.Name,
+		Pos:       ev.Pos,
+		Seq:       tr.count,
+		Backtrack: tr.backtrack,
+	}
+	tr.count++
+	tr.backtrack = false
+
+	if len(tr.stack) > 0 {
+		parent := tr.stack[len(tr.stack)-1]
+		parent.Calls = append(parent.Calls, call)
+	} else {
+		tr.Calls = append(tr.Calls, call)
+	}
+	tr.stack = append(tr.stack, call)
+}
+
+func (tr *TraceRecorder) Leave(ev *ParseEvent) {
+	if ev.Rule == nil || len(tr.stack) == 0 {
+		return
+	}
+	tr.stack[len(tr.stack)-1].Len = ev.Len
+	tr.stack = tr.stack[:len(tr.stack)-1]
+}
+
+// Backtracks returns the calls where the parser went back in the input, in
+// the order they were tried.
+func (tr *TraceRecorder) Backtracks() []*RuleCall {
+	var calls []*RuleCall
+	var walk func(cs []*RuleCall)
+	walk = func(cs []*RuleCall) {
+		for _, c := range cs {
+			if c.Backtrack {
+				calls = append(calls, c)
+			}
+			walk(c.Calls)
+		}
+	}
+	walk(tr.Calls)
+	return calls
+}
+
+const traceHTMLHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Parse trace</title>
+<style>
+body { font-family: sans-serif; }
+pre { position: relative; font-size: 14px; line-height: 1.6; white-space: pre-wrap; border: 1px solid #ccc; padding: 8px; }
+pre span:hover { outline: 1px solid #5a8; }
+.sel { position: absolute; background: #fde68a; opacity: 0.6; pointer-events: none; }
+details { margin-left: 16px; font-family: monospace; font-size: 13px; }
+summary { cursor: pointer; }
+.ok { color: #176b2c; }
+.ng { color: #b42318; }
+.bt { font-weight: bold; }
+.timeline { border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+`
+
+const traceHTMLScript = `<script>
+var input = document.getElementById("input");
+var marks = [];
+// point returns the text node and the offset in it of an offset of the input,
+// which is split by the spans of the rules.
+function point(pos) {
+  var walker = document.createTreeWalker(input, NodeFilter.SHOW_TEXT);
+  var node, last = null;
+  while ((node = walker.nextNode())) {
+    if (pos <= node.length) {
+      return [node, pos];
+    }
+    pos -= node.length;
+    last = node;
+  }
+  return last && [last, last.length];
+}
+// show highlights a span of the input with boxes over it, leaving the spans
+// of the rules in place.
+function show(pos, len) {
+  marks.forEach(function(m) { m.remove(); });
+  marks = [];
+  var start = point(pos), end = point(pos + Math.max(len, 1));
+  if (!start) {
+    return;
+  }
+  var range = document.createRange();
+  range.setStart(start[0], start[1]);
+  range.setEnd(end[0], end[1]);
+  var box = input.getBoundingClientRect();
+  Array.prototype.forEach.call(range.getClientRects(), function(r) {
+    var m = document.createElement("div");
+    m.className = "sel";
+    m.style.left = (r.left - box.left + input.scrollLeft) + "px";
+    m.style.top = (r.top - box.top + input.scrollTop) + "px";
+    m.style.width = Math.max(r.width, 2) + "px";
+    m.style.height = r.height + "px";
+    input.appendChild(m);
+    marks.push(m);
+  });
+  if (marks.length > 0) {
+    marks[0].scrollIntoView({block: "nearest"});
+  }
+}
+document.querySelectorAll("summary").forEach(function(s) {
+  s.addEventListener("click", function() {
+    show(+s.dataset.pos, +s.dataset.len);
+  });
+});
+</script>
+`
+
+// WriteHTML writes the trace as a self-contained HTML page. It shows the
+// input with the spans of the rules that matched, the tree of the rule calls
+// where failures are in a different color, and a timeline of the positions
+// of the calls where backtracks are marked. Clicking a call selects its span
+// in the input.
+func (tr *TraceRecorder) WriteHTML(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(traceHTMLHeader)
+
+	b.WriteString("<h2>Input</h2>\n<pre id=\"input\">")
+	tr.writeInput(&b)
+	b.WriteString("</pre>\n")
+
+	b.WriteString("<h2>Timeline</h2>\n")
+	tr.writeTimeline(&b)
+
+	b.WriteString("<h2>Rules</h2>\n")
+	units := utf16Offsets(tr.Input)
+	for _, c := range tr.Calls {
+		tr.writeCall(&b, c, units)
+	}
+
+	b.WriteString(traceHTMLScript)
+	b.WriteString("</body>\n</html>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeInput writes the input with nested spans of the calls that matched.
+func (tr *TraceRecorder) writeInput(b *bytes.Buffer) {
+	pos := 0
+	var write func(cs []*RuleCall)
+	write = func(cs []*RuleCall) {
+		for _, c := range cs {
+			if c.Len <= 0 || c.Pos < pos {
+				continue
+			}
+			b.WriteString(html.EscapeString(tr.Input[pos:c.Pos]))
+			fmt.Fprintf(b, `<span title="%s">`, html.EscapeString(c.Rule))
+			pos = c.Pos
+			write(c.Calls)
+			b.WriteString(html.EscapeString(tr.Input[pos : c.Pos+c.Len]))
+			b.WriteString("</span>")
+			pos = c.Pos + c.Len
+		}
+	}
+	write(tr.Calls)
+	b.WriteString(html.EscapeString(tr.Input[pos:]))
+}
+
+// utf16Offsets returns the offsets in UTF-16 code units, which JavaScript
+// strings are indexed by, of the byte offsets of s up to len(s).
+func utf16Offsets(s string) []int {
+	units := make([]int, len(s)+1)
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		// Offsets inside a character count from its start
+		for j := i; j < i+size; j++ {
+			units[j] = n
+		}
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+		i += size
+	}
+	units[len(s)] = n
+	return units
+}
+
+// writeCall writes a call and its nested calls. The span of the call is
+// written in UTF-16 offsets for the script.
+func (tr *TraceRecorder) writeCall(b *bytes.Buffer, c *RuleCall, units []int) {
+	ln, col := lineInfo(tr.Input, c.Pos)
+	class := "ng"
+	result := "failed"
+	if c.Len >= 0 {
+		class = "ok"
+		result = "matched " + html.EscapeString(fmt.Sprintf("%q", tr.Input[c.Pos:c.Pos+c.Len]))
+	}
+	if c.Backtrack {
+		class += " bt"
+	}
+
+	open := ""
+	l := c.Len
+	if c.Len >= 0 {
+		open = " open"
+		l = units[c.Pos+c.Len] - units[c.Pos]
+	}
+	fmt.Fprintf(b, `<details%s><summary class="%s" data-pos="%d" data-len="%d">#%d %s at %d:%d %s</summary>`,
+		open, class, units[c.Pos], l, c.Seq, html.EscapeString(c.Rule), ln, col, result)
+	b.WriteString("\n")
+	for _, child := range c.Calls {
+		tr.writeCall(b, child, units)
+	}
+	b.WriteString("</details>\n")
+}
+
+// writeTimeline writes an SVG chart of the positions of the calls in the
+// order they were tried, with backtracks in red.
+func (tr *TraceRecorder) writeTimeline(b *bytes.Buffer) {
+	const width, height = 1000, 200
+
+	x := func(seq int) float64 {
+		if tr.count <= 1 {
+			return 0
+		}
+		return float64(seq) * width / float64(tr.count-1)
+	}
+	y := func(pos int) float64 {
+		if len(tr.Input) == 0 {
+			return height
+		}
+		return height - float64(pos)*height/float64(len(tr.Input))
+	}
+
+	fmt.Fprintf(b, `<svg class="timeline" width="%d" height="%d" viewBox="-5 -5 %d %d">`, width+10, height+10, width+10, height+10)
+	b.WriteString("\n<polyline fill=\"none\" stroke=\"#5a8\" points=\"")
+	var walk func(cs []*RuleCall, fn func(c *RuleCall))
+	walk = func(cs []*RuleCall, fn func(c *RuleCall)) {
+		for _, c := range cs {
+			fn(c)
+			walk(c.Calls, fn)
+		}
+	}
+	walk(tr.Calls, func(c *RuleCall) {
+		fmt.Fprintf(b, "%.1f,%.1f ", x(c.Seq), y(c.Pos))
+	})
+	b.WriteString("\"/>\n")
+
+	backtracks := tr.Backtracks()
+	for _, c := range backtracks {
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="3" fill="#b42318"><title>#%d %s at %d</title></circle>`,
+			x(c.Seq), y(c.Pos), c.Seq, html.EscapeString(c.Rule), c.Pos)
+		b.WriteString("\n")
+	}
+	b.WriteString("</svg>\n")
+	fmt.Fprintf(b, "<p>%d rule calls, %d backtracks. The chart shows the input position of each call in the order they were tried.</p>\n",
+		tr.count, len(backtracks))
+}
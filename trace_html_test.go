@@ -0,0 +1,66 @@
+package peg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- A 'x' / A 'y' / B
+        A    <- 'a'
+        B    <- 'b'
+    `)
+	tr := NewTraceRecorder()
+	p.Observer = tr
+
+	p.Parse("b", nil)
+	assert(t, p.Parse("ay", nil) == nil)
+
+	assert(t, tr.Input == "ay")
+	assert(t, len(tr.Calls) == 1)
+	root := tr.Calls[0]
+	assert(t, root.Rule == "ROOT" && root.Len == 2)
+	assert(t, len(root.Calls) == 2)
+	assert(t, root.Calls[0].Seq == 1 && !root.Calls[0].Backtrack)
+	assert(t, root.Calls[1].Seq == 2 && root.Calls[1].Backtrack)
+
+	bts := tr.Backtracks()
+	assert(t, len(bts) == 1 && bts[0] == root.Calls[1])
+
+	var b bytes.Buffer
+	if err := tr.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	assert(t, strings.Contains(out, `<pre id="input"><span title="ROOT"><span title="A">a</span>y</span></pre>`))
+	assert(t, strings.Contains(out, `<summary class="ok bt" data-pos="0" data-len="1">#2 A at 1:1 matched &#34;a&#34;</summary>`))
+	assert(t, strings.Contains(out, "3 rule calls, 1 backtracks"))
+
+	// The selection doesn't rewrite the spans of the input
+	assert(t, !strings.Contains(out, "textContent ="))
+	assert(t, strings.Contains(out, "getClientRects"))
+
+	p.Parse("c", nil)
+	b.Reset()
+	tr.WriteHTML(&b)
+	assert(t, strings.Contains(b.String(), `<summary class="ng" data-pos="0" data-len="-1">#0 ROOT at 1:1 failed</summary>`))
+}
+
+func TestTraceRecorderUTF16(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- A B
+        A    <- 'é😀'
+        B    <- 'b'
+    `)
+	tr := NewTraceRecorder()
+	p.Observer = tr
+	assert(t, p.Parse("é😀b", nil) == nil)
+
+	var b bytes.Buffer
+	assert(t, tr.WriteHTML(&b) == nil)
+	out := b.String()
+	assert(t, strings.Contains(out, `data-pos="0" data-len="3">#1 A at 1:1`))
+	assert(t, strings.Contains(out, `data-pos="3" data-len="1">#2 B at 1:7`))
+}
@@ -0,0 +1,279 @@
+package peg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTraceText(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- 'a' 'b' / 'a'
+    `)
+	var b bytes.Buffer
+	p.EnableTracing(&TracingOptions{
+		ShowRuleEntry: true,
+		ShowRuleExit:  true,
+		Output:        &b,
+	})
+	assert(t, p.Parse("a", nil) == nil)
+
+	expected := `0:0	[ROOT]
+0:1	  prioritizedChoice
+0:2	    sequence
+0:3	      literalString
+0:3	      literalString (SUCCESS, len=1)
+1:3	      literalString
+1:3	      literalString (FAILED)
+0:2	    sequence (FAILED)
+0:2*	    literalString
+0:2	    literalString (SUCCESS, len=1)
+0:1	  prioritizedChoice (SUCCESS, len=1)
+0:0	[ROOT] (SUCCESS, len=1)
+`
+	if b.String() != expected {
+		t.Errorf("trace:\n%s", b.String())
+	}
+}
+
+func TestTraceJSON(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT        <- NUMBER+
+        NUMBER      <- < [0-9]+ >
+        %whitespace <- ' '*
+    `)
+	var b bytes.Buffer
+	p.EnableTracing(&TracingOptions{
+		ShowRuleExit:     true,
+		ShowTokens:       true,
+		ShowErrorContext: true,
+		OutputFormat:     "json",
+		Output:           &b,
+	})
+	p.Parse("12 3 x", nil)
+
+	type event struct {
+		Event   string
+		Name    string
+		Rule    string
+		Pos     *int
+		Depth   int
+		Len     *int
+		Success *bool
+		Token   string
+		Message string
+	}
+	var events []event
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		var ev event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+
+	var tokens []string
+	var numbers []int
+	for _, ev := range events {
+		switch {
+		case ev.Event == "enter":
+			t.Errorf("unexpected enter event")
+		case ev.Event == "token":
+			tokens = append(tokens, ev.Token)
+		case ev.Event == "leave" && ev.Rule == "NUMBER" && *ev.Success:
+			numbers = append(numbers, *ev.Pos)
+		}
+	}
+	assert(t, strings.Join(tokens, " ") == "12 3")
+	assert(t, len(numbers) == 2 && numbers[0] == 0 && numbers[1] == 3)
+
+	last := events[len(events)-1]
+	assert(t, last.Event == "error")
+	assert(t, last.Pos == nil)
+	assert(t, strings.Contains(last.Message, "not exact match"))
+}
+
+type recordingSink struct {
+	events []*TraceEvent
+}
+
+func (r *recordingSink) Trace(ev *TraceEvent) {
+	r.events = append(r.events, ev)
+}
+
+func TestTraceSink(t *testing.T) {
+	p, _ := NewParser(`
+        ROOT <- A / B
+        A    <- 'a'
+        B    <- 'b'
+    `)
+	sink := &recordingSink{}
+	p.EnableTracing(&TracingOptions{
+		ShowRuleEntry: true,
+		Sink:          sink,
+	})
+	p.Parse("b", nil)
+
+	var rules []string
+	for _, ev := range sink.events {
+		if ev.Rule != "" {
+			rules = append(rules, ev.Rule)
+		}
+		if ev.Rule == "B" {
+			assert(t, ev.Backtrack == false)
+			assert(t, ev.Depth == 3)
+		}
+	}
+	assert(t, strings.Join(rules, " ") == "ROOT A B")
+}
+
+const traceFilterGrammar = `
+    ROOT        <- ITEM (',' ITEM)*
+    ITEM        <- NUMBER / NAME
+    NUMBER      <- < [0-9]+ >
+    NAME        <- < [a-z]+ >
+    %whitespace <- [ ]*
+`
+
+func traceEvents(t *testing.T, input string, options TracingOptions) []*TraceEvent {
+	p, _ := NewParser(traceFilterGrammar)
+	sink := &recordingSink{}
+	options.Sink = sink
+	p.EnableTracing(&options)
+	p.Parse(input, nil)
+	return sink.events
+}
+
+func TestTraceFilterRules(t *testing.T) {
+	events := traceEvents(t, "1, x", TracingOptions{
+		ShowRuleEntry: true,
+		IncludeRules:  []string{"N*"},
+		RulesOnly:     true,
+	})
+	var rules []string
+	for _, ev := range events {
+		rules = append(rules, ev.Rule)
+	}
+	assert(t, strings.Join(rules, " ") == "NUMBER NUMBER NAME")
+
+	events = traceEvents(t, "1, x", TracingOptions{
+		ShowRuleEntry: true,
+		IncludeRules:  []string{"NAME"},
+	})
+	assert(t, len(events) > 1)
+	for _, ev := range events {
+		assert(t, ev.Pos >= 3)
+		assert(t, ev.Rule == "NAME" || ev.Rule == "")
+	}
+
+	events = traceEvents(t, "1, x", TracingOptions{
+		ShowRuleExit: true,
+		ExcludeRules: []string{"%*", "ITEM"},
+	})
+	for _, ev := range events {
+		assert(t, ev.Rule != "%whitespace" && ev.Rule != "ITEM")
+		assert(t, ev.Name != "characterClass" || ev.Depth > 5)
+	}
+}
+
+func TestTraceFilterRange(t *testing.T) {
+	events := traceEvents(t, "1, 23, x", TracingOptions{
+		ShowRuleEntry: true,
+		ShowRuleExit:  true,
+		StartPos:      3,
+		EndPos:        5,
+		MaxDepth:      10,
+	})
+	assert(t, len(events) > 0)
+	for _, ev := range events {
+		assert(t, ev.Pos >= 3 && ev.Pos < 5)
+		assert(t, ev.Depth <= 10)
+	}
+}
+
+func TestTraceFarthestFailures(t *testing.T) {
+	all := traceEvents(t, "1, 2,", TracingOptions{ShowRuleExit: true})
+	farthest := -1
+	for _, ev := range all {
+		if ev.Len < 0 && ev.Pos > farthest {
+			farthest = ev.Pos
+		}
+	}
+
+	p, _ := NewParser(traceFilterGrammar)
+	sink := &recordingSink{}
+	p.EnableTracing(&TracingOptions{
+		FarthestFailuresOnly: true,
+		RulesOnly:            true,
+		Sink:                 sink,
+	})
+	p.Parse("1, 2,", nil)
+
+	var rules []string
+	for _, ev := range sink.events {
+		assert(t, ev.Kind == TraceLeave)
+		assert(t, ev.Len == -1)
+		assert(t, ev.Pos == farthest)
+		rules = append(rules, ev.Rule)
+	}
+	assert(t, strings.Join(rules, " ") == "NUMBER NAME ITEM")
+
+	// Events are written at the end of each parse
+	sink.events = nil
+	p.Parse("x,", nil)
+	assert(t, len(sink.events) == 3)
+	assert(t, sink.events[0].Pos == 2)
+}
+
+func TestTraceRulesOnlyTokens(t *testing.T) {
+	events := traceEvents(t, "1, x", TracingOptions{
+		ShowRuleExit: true,
+		ShowTokens:   true,
+		RulesOnly:    true,
+	})
+	var tokens []string
+	for _, ev := range events {
+		if ev.Kind == TraceToken {
+			tokens = append(tokens, ev.Token)
+		} else {
+			assert(t, ev.Rule != "")
+		}
+	}
+	assert(t, strings.Join(tokens, " ") == "1 x")
+}
+
+func TestTraceEventKindString(t *testing.T) {
+	assert(t, TraceToken.String() == "token")
+	assert(t, TraceEventKind(7).String() == "TraceEventKind(7)")
+	assert(t, TraceEventKind(-1).String() == "TraceEventKind(-1)")
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestTraceSinkErr(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		p, _ := NewParser(traceFilterGrammar)
+		w := &failingWriter{}
+		p.EnableTracing(&TracingOptions{
+			ShowRuleEntry: true,
+			OutputFormat:  format,
+			Output:        w,
+		})
+		assert(t, p.Parse("1, x", nil) == nil)
+		assert(t, p.TraceErr() != nil && p.TraceErr().Error() == "disk full")
+		assert(t, w.writes == 1)
+	}
+
+	p, _ := NewParser(traceFilterGrammar)
+	p.EnableTracing(&TracingOptions{ShowRuleEntry: true, Sink: &recordingSink{}})
+	assert(t, p.TraceErr() == nil)
+}
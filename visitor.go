@@ -143,10 +143,11 @@ func (v *detectLeftRecursion) visitExpression(ope *expression) { ope.atom.accept
 // referenceChecker
 type referenceChecker struct {
 	*visitorBase
-	grammar  map[string]*Rule
-	params   []string
-	errorPos map[string]int
-	errorMsg map[string]string
+	grammar   map[string]*Rule
+	params    []string
+	errorPos  map[string]int
+	errorMsg  map[string]string
+	errorType map[string]string
 }
 
 func (v *referenceChecker) visitSequence(ope *sequence) {
@@ -176,15 +177,18 @@ func (v *referenceChecker) visitReference(ope *reference) {
 	if r, ok := v.grammar[ope.name]; !ok {
 		v.errorPos[ope.name] = ope.pos
 		v.errorMsg[ope.name] = "'" + ope.name + "' is not defined."
+		v.errorType[ope.name] = "undefined rule"
 	} else if r.Parameters != nil {
 		if ope.args == nil || len(ope.args) != len(r.Parameters) {
 			v.errorPos[ope.name] = ope.pos
 			v.errorMsg[ope.name] = "incorrect number of arguments."
+			v.errorType[ope.name] = "argument mismatch"
 		}
 	} else {
 		if ope.args != nil {
 			v.errorPos[ope.name] = ope.pos
 			v.errorMsg[ope.name] = "'" + ope.name + "' is not macro."
+			v.errorType[ope.name] = "argument mismatch"
 		}
 	}
 }
@@ -238,13 +242,13 @@ func (v *linkReferences) visitExpression(ope *expression) { ope.atom.accept(v) }
 // findReference
 type findReference struct {
 	*visitorBase
-	args   []operator
+	args   []Operator
 	params []string
-	ope    operator
+	ope    Operator
 }
 
 func (v *findReference) visitSequence(ope *sequence) {
-	var opes []operator
+	var opes []Operator
 	for _, o := range ope.opes {
 		o.accept(v)
 		opes = append(opes, v.ope)
@@ -252,12 +256,17 @@ func (v *findReference) visitSequence(ope *sequence) {
 	v.ope = SeqCore(opes)
 }
 func (v *findReference) visitPrioritizedChoice(ope *prioritizedChoice) {
-	var opes []operator
+	var opes []Operator
 	for _, o := range ope.opes {
 		o.accept(v)
 		opes = append(opes, v.ope)
 	}
-	v.ope = ChoCore(opes)
+	cho := ChoCore(opes).(*prioritizedChoice)
+	cho.source = ope
+	if ope.source != nil {
+		cho.source = ope.source
+	}
+	v.ope = cho
 }
 func (v *findReference) visitZeroOrMore(ope *zeroOrMore) {
 	ope.ope.accept(v)
@@ -317,3 +326,68 @@ func (v *findReference) visitExpression(ope *expression) {
 	ope.atom.accept(v)
 	v.ope = ope
 }
+
+// nodeInspector
+type nodeInspector struct {
+	node Node
+}
+
+// copyOpes copies operands, keeping nil apart from an empty list.
+func copyOpes(opes []Operator) []Operator {
+	if opes == nil {
+		return nil
+	}
+	return append([]Operator{}, opes...)
+}
+
+func (v *nodeInspector) visitSequence(ope *sequence) {
+	v.node = Node{Kind: SequenceNode, Opes: copyOpes(ope.opes)}
+}
+func (v *nodeInspector) visitPrioritizedChoice(ope *prioritizedChoice) {
+	v.node = Node{Kind: ChoiceNode, Opes: copyOpes(ope.opes)}
+}
+func (v *nodeInspector) visitZeroOrMore(ope *zeroOrMore) {
+	v.node = Node{Kind: ZeroOrMoreNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitOneOrMore(ope *oneOrMore) {
+	v.node = Node{Kind: OneOrMoreNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitOption(ope *option) {
+	v.node = Node{Kind: OptionNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitAndPredicate(ope *andPredicate) {
+	v.node = Node{Kind: AndPredicateNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitNotPredicate(ope *notPredicate) {
+	v.node = Node{Kind: NotPredicateNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitLiteralString(ope *literalString) {
+	v.node = Node{Kind: LiteralNode, Lit: ope.lit}
+}
+func (v *nodeInspector) visitCharacterClass(ope *characterClass) {
+	v.node = Node{Kind: ClassNode, Chars: ope.chars}
+}
+func (v *nodeInspector) visitAnyCharacter(ope *anyCharacter) {
+	v.node = Node{Kind: AnyCharacterNode}
+}
+func (v *nodeInspector) visitTokenBoundary(ope *tokenBoundary) {
+	v.node = Node{Kind: TokenBoundaryNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitIgnore(ope *ignore) {
+	v.node = Node{Kind: IgnoreNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitUser(ope *user) {
+	v.node = Node{Kind: UserNode}
+}
+func (v *nodeInspector) visitReference(ope *reference) {
+	v.node = Node{Kind: ReferenceNode, Name: ope.name, Args: copyOpes(ope.args), Param: ope.rule == nil, Pos: ope.pos, rule: ope.rule}
+}
+func (v *nodeInspector) visitRule(ope *Rule) {
+	v.node = Node{Kind: RuleNode, Opes: []Operator{ope.Ope}, Name: ope.Name, Pos: ope.Pos, rule: ope}
+}
+func (v *nodeInspector) visitWhitespace(ope *whitespace) {
+	v.node = Node{Kind: WhitespaceNode, Opes: []Operator{ope.ope}}
+}
+func (v *nodeInspector) visitExpression(ope *expression) {
+	v.node = Node{Kind: ExpressionNode, Opes: []Operator{ope.atom, ope.binop}}
+}